@@ -37,7 +37,7 @@ func collect(c *cli.Context) error {
 		return err
 	}
 	dest := filepath.Join(repoPath, key)
-	if err := copyMDs(c, source, dest); err != nil {
+	if err := copyMDs(c, source, dest, repoPath); err != nil {
 		return err
 	}
 	return nil
@@ -2,6 +2,9 @@ package conf
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/slipfre/imgmd/provider"
 	"github.com/slipfre/imgmd/provider/factory"
@@ -53,3 +56,84 @@ func GetRepoPathFromConfig(path string) (repoPath string, err error) {
 	}
 	return
 }
+
+// GetKeyTemplatesFromConfigFile 解析配置文件中依赖的 key 模板。local 为 'LOCAL' 中收集到本地时
+// 使用的模板，obs 为 'OBS' 中上传到 bucket 时使用的模板，未配置时为空
+func GetKeyTemplatesFromConfigFile(path string) (local, obs string, err error) {
+	viper.SetConfigFile(path)
+	if err = viper.ReadInConfig(); err != nil {
+		return
+	}
+	local = viper.GetStringMapString("LOCAL")["key_template"]
+	obs = viper.GetStringMapString("OBS")["key_template"]
+	return
+}
+
+// RateLimits 请求速率和带宽的限制，0 表示不限制
+type RateLimits struct {
+	RequestsPerSecond float64
+	BytesPerSecond    int
+}
+
+// Merge 返回以 limits 中已配置的项覆盖 l 的结果
+func (l RateLimits) Merge(limits RateLimits) RateLimits {
+	if limits.RequestsPerSecond > 0 {
+		l.RequestsPerSecond = limits.RequestsPerSecond
+	}
+	if limits.BytesPerSecond > 0 {
+		l.BytesPerSecond = limits.BytesPerSecond
+	}
+	return l
+}
+
+// GetRateLimitsFromConfigFile 解析配置文件中的速率限制。global 为 'LIMITS' 中的全局限制，
+// obs 为 'OBS' 中只作用于 bucket 的限制，未配置的项为 0
+func GetRateLimitsFromConfigFile(path string) (global, obs RateLimits, err error) {
+	viper.SetConfigFile(path)
+	if err = viper.ReadInConfig(); err != nil {
+		return
+	}
+	if global, err = parseRateLimits(viper.GetStringMapString("LIMITS")); err != nil {
+		return
+	}
+	obs, err = parseRateLimits(viper.GetStringMapString("OBS"))
+	return
+}
+
+func parseRateLimits(section map[string]string) (limits RateLimits, err error) {
+	if rps := section["rps"]; rps != "" {
+		if limits.RequestsPerSecond, err = strconv.ParseFloat(rps, 64); err != nil {
+			err = fmt.Errorf("invalid 'RPS': %s", rps)
+			return
+		}
+	}
+	if bandwidth := section["bandwidth"]; bandwidth != "" {
+		limits.BytesPerSecond, err = ParseBytes(bandwidth)
+	}
+	return
+}
+
+// ParseBytes 解析字节数，支持 K、M、G 单位，如 512K、2MB、1.5MiB，单位均以 1024 为基数
+func ParseBytes(s string) (int, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	unit := 1.0
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid bytes: '%s'", s)
+	}
+	return int(number * unit), nil
+}
@@ -18,7 +18,7 @@ func copy(c *cli.Context) error {
 		return err
 	}
 
-	if err := copyMDs(c, source, destination); err != nil {
+	if err := copyMDs(c, source, destination, ""); err != nil {
 		return err
 	}
 
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// withInterrupt Returns a context which is cancelled on the first SIGINT or
+// SIGTERM, so that the collectors stop starting new work while the in-flight
+// writes finish or roll back. A second signal kills the process as usual.
+// interrupted reports whether a signal was received, and stop releases the
+// signal handling
+func withInterrupt(parent context.Context) (ctx context.Context, interrupted func() bool, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	var received int32
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			atomic.StoreInt32(&received, 1)
+			signal.Stop(signals)
+			log.Printf("Received %s, waiting for the in-flight writes. Interrupt again to quit at once\n", sig)
+			cancel()
+		case <-done:
+		}
+	}()
+	return ctx, func() bool {
+			return atomic.LoadInt32(&received) == 1
+		}, func() {
+			signal.Stop(signals)
+			close(done)
+			cancel()
+		}
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slipfre/imgmd/collector"
+)
+
+const (
+	progressBarWidth    = 30
+	progressRefreshRate = 200 * time.Millisecond
+	// progressMaxFiles The max number of uploading files shown at once
+	progressMaxFiles = 5
+)
+
+// fileProgress The progress of uploading a file
+type fileProgress struct {
+	target      string
+	transferred int64
+	total       int64
+}
+
+// progress Observer drawing the overall progress of the documents and the bars
+// of the files being uploaded, with the throughput
+type progress struct {
+	mutex     sync.Mutex
+	w         io.Writer
+	start     time.Time
+	documents int
+	finished  int
+	failed    int
+	skipped   int
+	uploaded  int
+	rewritten int
+	bytes     int64
+	files     map[string]*fileProgress
+	order     []string
+	lines     int
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// newProgress Returns a progress of the documents drawn to w
+func newProgress(w io.Writer, documents int) *progress {
+	return &progress{
+		w:         w,
+		start:     time.Now(),
+		documents: documents,
+		files:     make(map[string]*fileProgress),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// observe Update the progress by the event
+func (p *progress) observe(event collector.Event) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch event.Type {
+	case collector.EventFinished:
+		p.finished++
+		if event.Err != nil {
+			p.failed++
+		}
+	case collector.EventSkippedFresh:
+		p.skipped++
+	case collector.EventRewritten:
+		p.rewritten++
+	case collector.EventUploadProgress:
+		file, ok := p.files[event.Target]
+		if !ok {
+			file = &fileProgress{target: event.Target}
+			p.files[event.Target] = file
+			p.order = append(p.order, event.Target)
+		}
+		if event.Transferred > file.transferred {
+			p.bytes += event.Transferred - file.transferred
+		}
+		file.transferred, file.total = event.Transferred, event.Total
+	case collector.EventUploaded:
+		p.uploaded++
+		p.remove(event.Target)
+	case collector.EventFailed:
+		p.remove(event.Target)
+	}
+}
+
+// remove Remove the bar of the file, the caller should hold the mutex
+func (p *progress) remove(target string) {
+	if _, ok := p.files[target]; !ok {
+		return
+	}
+	delete(p.files, target)
+	for i, t := range p.order {
+		if t == target {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// run Redraw the progress periodically until stop is called
+func (p *progress) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(progressRefreshRate)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.draw()
+		case <-p.done:
+			p.draw()
+			return
+		}
+	}
+}
+
+// stop Draw the final progress and stop redrawing
+func (p *progress) stop() {
+	close(p.done)
+	<-p.stopped
+}
+
+// draw Redraw the progress over the one drawn last time
+func (p *progress) draw() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	builder := strings.Builder{}
+	if p.lines > 0 {
+		// Move the cursor up to the first line drawn last time, and clear
+		// the lines below
+		builder.WriteString(fmt.Sprintf("\033[%dA\033[J", p.lines))
+	}
+
+	elapsed := time.Since(p.start).Seconds()
+	throughput := float64(0)
+	if elapsed > 0 {
+		throughput = float64(p.bytes) / elapsed
+	}
+	builder.WriteString(fmt.Sprintf("%s %d/%d documents, %d failed | %d uploaded, %d written, %d fresh | %s at %s/s\n",
+		progressBar(int64(p.finished), int64(p.documents)), p.finished, p.documents, p.failed,
+		p.uploaded, p.rewritten, p.skipped, formatBytes(p.bytes), formatBytes(int64(throughput))))
+	lines := 1
+	for i, target := range p.order {
+		if i == progressMaxFiles {
+			builder.WriteString(fmt.Sprintf("  ... and %d more\n", len(p.order)-progressMaxFiles))
+			lines++
+			break
+		}
+		file := p.files[target]
+		size := formatBytes(file.transferred)
+		if file.total >= 0 {
+			size += "/" + formatBytes(file.total)
+		}
+		builder.WriteString(fmt.Sprintf("  %s %s %s\n", progressBar(file.transferred, file.total), size, filepath.Base(target)))
+		lines++
+	}
+	p.lines = lines
+	fmt.Fprint(p.w, builder.String())
+}
+
+// progressBar Returns a bar of done of total, or an empty bar if total is
+// unknown
+func progressBar(done, total int64) string {
+	filled := 0
+	if total > 0 {
+		filled = int(done * progressBarWidth / total)
+	}
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled) + "]"
+}
+
+// formatBytes Format the size in bytes in the units of 1024
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value := float64(size)
+	units := []string{"K", "M", "G", "T"}
+	i := -1
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", value, units[i])
+}
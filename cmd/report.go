@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slipfre/imgmd/collector"
+	"github.com/slipfre/imgmd/manifest"
+	"github.com/slipfre/imgmd/utils"
+)
+
+// printErrorReport Print the errors grouped by document, with the stage, the
+// dependency and the original error of each failure
+func printErrorReport(w io.Writer, errs []*collector.FileError) {
+	if len(errs) == 0 {
+		return
+	}
+	documents := make([]string, 0)
+	grouped := make(map[string][]*collector.FileError)
+	for _, err := range errs {
+		if _, ok := grouped[err.Document]; !ok {
+			documents = append(documents, err.Document)
+		}
+		grouped[err.Document] = append(grouped[err.Document], err)
+	}
+	sort.Strings(documents)
+
+	fmt.Fprintf(w, "Failed documents: %d, errors: %d\n", len(documents), len(errs))
+	for _, document := range documents {
+		fmt.Fprintf(w, "%s\n", document)
+		for _, err := range grouped[document] {
+			stage := err.Stage
+			if stage == "" {
+				stage = "collect"
+			}
+			file := err.Target
+			if err.Dependency != "" {
+				file = fmt.Sprintf("%s -> %s", err.Dependency, err.Target)
+			}
+			fmt.Fprintf(w, "  [%s] %s\n      %s\n", stage, file, err.Err.Error())
+		}
+	}
+}
+
+const (
+	reportJSON  = "json"
+	reportJUnit = "junit"
+)
+
+// parseReportFormat Validate the format of the run report, empty for no report
+func parseReportFormat(format string) (string, error) {
+	switch format {
+	case "", reportJSON, reportJUnit:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown report format '%s', expect '%s' or '%s'", format, reportJSON, reportJUnit)
+}
+
+// runReport Observer recording what a run did to each document, which is
+// written as a machine readable report at the end of the run
+type runReport struct {
+	mutex     sync.Mutex
+	start     time.Time
+	documents map[string]*documentReport
+	order     []string
+}
+
+// documentReport What a run did to a document and its dependencies
+type documentReport struct {
+	Source       string              `json:"source"`
+	Target       string              `json:"target"`
+	Location     manifest.Location   `json:"location"`
+	Status       string              `json:"status"`
+	Action       string              `json:"action,omitempty"`
+	StartedAt    time.Time           `json:"startedAt"`
+	Duration     float64             `json:"durationSeconds"`
+	Dependencies []*dependencyReport `json:"dependencies"`
+	Errors       []reportError       `json:"errors,omitempty"`
+
+	dependencies map[string]*dependencyReport
+}
+
+// dependencyReport What a run did to a dependency. Action is empty if the
+// dependency is inlined, or collected for another document sharing it
+type dependencyReport struct {
+	Source   string            `json:"source"`
+	Target   string            `json:"target"`
+	Location manifest.Location `json:"location"`
+	Action   string            `json:"action,omitempty"`
+	Duration float64           `json:"durationSeconds"`
+	Stage    string            `json:"stage,omitempty"`
+	Error    string            `json:"error,omitempty"`
+
+	discoveredAt time.Time
+}
+
+// reportError A failure of a document
+type reportError struct {
+	Dependency string `json:"dependency,omitempty"`
+	Target     string `json:"target"`
+	Stage      string `json:"stage,omitempty"`
+	Message    string `json:"message"`
+}
+
+// reportTotals The totals of a run
+type reportTotals struct {
+	Documents    int   `json:"documents"`
+	Succeeded    int   `json:"succeeded"`
+	Failed       int   `json:"failed"`
+	Dependencies int   `json:"dependencies"`
+	Uploaded     int   `json:"uploaded"`
+	Rewritten    int   `json:"rewritten"`
+	Skipped      int   `json:"skipped"`
+	Errors       int   `json:"errors"`
+	Retries      int64 `json:"retries"`
+}
+
+// newRunReport Constructor for runReport
+func newRunReport() *runReport {
+	return &runReport{
+		start:     time.Now(),
+		documents: make(map[string]*documentReport),
+	}
+}
+
+// observe Record the event
+func (r *runReport) observe(event collector.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	document, ok := r.documents[event.Document]
+	if !ok {
+		document = &documentReport{
+			Source:       event.Document,
+			Dependencies: make([]*dependencyReport, 0),
+			dependencies: make(map[string]*dependencyReport),
+		}
+		r.documents[event.Document] = document
+		r.order = append(r.order, event.Document)
+	}
+	switch event.Type {
+	case collector.EventDocumentStarted:
+		document.Target = event.Target
+		document.StartedAt = event.Time
+		return
+	case collector.EventFinished:
+		document.Duration = event.Time.Sub(document.StartedAt).Seconds()
+		document.Status = "succeeded"
+		if event.Err != nil {
+			document.Status = "failed"
+			for _, err := range collector.FileErrors(event.Err) {
+				document.Errors = append(document.Errors, reportError{
+					Dependency: err.Dependency,
+					Target:     err.Target,
+					Stage:      string(err.Stage),
+					Message:    err.Err.Error(),
+				})
+			}
+		}
+		return
+	}
+
+	if event.Type != collector.EventDependencyDiscovered && event.Target == document.Target {
+		document.Action = string(event.Type)
+		if event.Type != collector.EventFailed {
+			document.Location = event.Location
+		}
+		return
+	}
+	dependency, ok := document.dependencies[event.Target]
+	if !ok {
+		dependency = &dependencyReport{Source: event.File, Target: event.Target, discoveredAt: event.Time}
+		document.dependencies[event.Target] = dependency
+		document.Dependencies = append(document.Dependencies, dependency)
+	}
+	switch event.Type {
+	case collector.EventSkippedFresh, collector.EventUploaded, collector.EventRewritten:
+		dependency.Action = string(event.Type)
+		dependency.Location = event.Location
+		dependency.Duration = event.Time.Sub(dependency.discoveredAt).Seconds()
+	case collector.EventFailed:
+		err := collector.FileErrors(event.Err)[0]
+		dependency.Action = string(event.Type)
+		dependency.Stage = string(err.Stage)
+		dependency.Error = err.Err.Error()
+		dependency.Duration = event.Time.Sub(dependency.discoveredAt).Seconds()
+	}
+}
+
+// sorted Returns the documents sorted by source, the caller should hold the
+// mutex
+func (r *runReport) sorted() []*documentReport {
+	documents := make([]*documentReport, 0, len(r.order))
+	for _, source := range r.order {
+		documents = append(documents, r.documents[source])
+	}
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].Source < documents[j].Source
+	})
+	return documents
+}
+
+// totals Returns the totals of the documents, the caller should hold the mutex
+func (r *runReport) totals(documents []*documentReport, retries int64) reportTotals {
+	totals := reportTotals{Documents: len(documents), Retries: retries}
+	for _, document := range documents {
+		if document.Status == "succeeded" {
+			totals.Succeeded++
+		} else {
+			totals.Failed++
+		}
+		totals.Errors += len(document.Errors)
+		totals.Dependencies += len(document.Dependencies)
+		actions := []string{document.Action}
+		for _, dependency := range document.Dependencies {
+			actions = append(actions, dependency.Action)
+		}
+		for _, action := range actions {
+			switch collector.EventType(action) {
+			case collector.EventUploaded:
+				totals.Uploaded++
+			case collector.EventRewritten:
+				totals.Rewritten++
+			case collector.EventSkippedFresh:
+				totals.Skipped++
+			}
+		}
+	}
+	return totals
+}
+
+// write Write the report in the format to w
+func (r *runReport) write(w io.Writer, format string, retries int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	documents := r.sorted()
+	duration := time.Since(r.start).Seconds()
+	if format == reportJUnit {
+		return writeJUnitReport(w, documents, duration)
+	}
+	totals := r.totals(documents, retries)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		StartedAt time.Time         `json:"startedAt"`
+		Duration  float64           `json:"durationSeconds"`
+		Totals    reportTotals      `json:"totals"`
+		Documents []*documentReport `json:"documents"`
+	}{r.start, duration, totals, documents})
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport Write the report as JUnit XML, where each document is a test
+// suite, and the document and each of its dependencies are test cases
+func writeJUnitReport(w io.Writer, documents []*documentReport, duration float64) error {
+	suites := junitTestSuites{Name: "cres", Time: formatSeconds(duration)}
+	for _, document := range documents {
+		suite := junitTestSuite{Name: document.Source, Time: formatSeconds(document.Duration)}
+		documentCase := junitTestCase{
+			ClassName: document.Source,
+			Name:      document.Source,
+			Time:      formatSeconds(document.Duration),
+			SystemOut: locationOf(document.Location),
+		}
+		if len(document.Errors) > 0 {
+			messages := make([]string, len(document.Errors))
+			for i, err := range document.Errors {
+				messages[i] = fmt.Sprintf("[%s] %s: %s", err.Stage, err.Target, err.Message)
+			}
+			documentCase.Failure = &junitMessage{Message: "document failed", Text: strings.Join(messages, "\n")}
+		} else if document.Action == string(collector.EventSkippedFresh) {
+			documentCase.Skipped = &junitMessage{Message: "fresh"}
+		}
+		suite.Cases = append(suite.Cases, documentCase)
+		for _, dependency := range document.Dependencies {
+			dependencyCase := junitTestCase{
+				ClassName: document.Source,
+				Name:      dependency.Source,
+				Time:      formatSeconds(dependency.Duration),
+				SystemOut: locationOf(dependency.Location),
+			}
+			switch collector.EventType(dependency.Action) {
+			case collector.EventFailed:
+				dependencyCase.Failure = &junitMessage{Message: "dependency failed", Text: dependency.Error}
+			case collector.EventSkippedFresh:
+				dependencyCase.Skipped = &junitMessage{Message: "fresh"}
+			}
+			suite.Cases = append(suite.Cases, dependencyCase)
+		}
+		for _, testCase := range suite.Cases {
+			suite.Tests++
+			if testCase.Failure != nil {
+				suite.Failures++
+			}
+			if testCase.Skipped != nil {
+				suite.Skipped++
+			}
+		}
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// locationOf Returns the url or the path of the location
+func locationOf(location manifest.Location) string {
+	if location.URL != "" {
+		return location.URL
+	}
+	return location.Path
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// writeRunReport Write the report to the file at path, or the standard output
+// if path is empty
+func writeRunReport(report *runReport, format, path string, retries int64) error {
+	if path == "" {
+		return report.write(os.Stdout, format, retries)
+	}
+	buffer := bytes.Buffer{}
+	if err := report.write(&buffer, format, retries); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, buffer.Bytes(), 0666)
+}
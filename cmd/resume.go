@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/slipfre/imgmd/manifest"
+	"github.com/slipfre/imgmd/utils"
+)
+
+// resumeFileName The name of the file keeping the state of an interrupted run,
+// beside the manifest
+const resumeFileName = "resume.json"
+
+// resumeState The documents left by an interrupted run, which are collected by
+// the next run with --resume
+type resumeState struct {
+	Source        string    `json:"source"`
+	Destination   string    `json:"destination"`
+	InterruptedAt time.Time `json:"interruptedAt"`
+	Remaining     []string  `json:"remaining"`
+}
+
+// resumeStatePath Returns the path of the state of the repository at root
+func resumeStatePath(root string) string {
+	return filepath.Join(root, manifest.Dir, resumeFileName)
+}
+
+// loadResumeState Load the state at path, nil if there is none
+func loadResumeState(path string) (*resumeState, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &resumeState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid resume state '%s': %s", path, err.Error())
+	}
+	return state, nil
+}
+
+// save Save the state to path atomically
+func (s *resumeState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, data, 0666)
+}
+
+// match Returns an error if the state is not left by a run from source to
+// destination
+func (s *resumeState) match(source, destination string) error {
+	if s.Source != source || s.Destination != destination {
+		return fmt.Errorf("the run to resume collected '%s' to '%s' rather than '%s' to '%s'",
+			s.Source, s.Destination, source, destination)
+	}
+	return nil
+}
+
+// removeResumeState Remove the state at path if any
+func removeResumeState(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -7,12 +7,17 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"reflect"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/slipfre/imgmd/cmd/conf"
 	"github.com/slipfre/imgmd/collectable"
 	"github.com/slipfre/imgmd/collector"
+	"github.com/slipfre/imgmd/manifest"
+	"github.com/slipfre/imgmd/provider"
+	"github.com/slipfre/imgmd/utils"
 	"github.com/urfave/cli/v2"
 )
 
@@ -36,38 +41,213 @@ func parseCollectArguments(c *cli.Context) (key string, err error) {
 	return
 }
 
-func parseGlobalFlags(c *cli.Context) (types []string, recursive bool, config string, dep2obs []string) {
-	types = c.StringSlice("type")
-	recursive = c.Bool("recursive")
-	config = c.Path("config")
-	dep2obs = c.StringSlice("dep2obs")
+// globalFlags Flags shared by commands
+type globalFlags struct {
+	types           []string
+	recursive       bool
+	config          string
+	dep2obs         []string
+	extractEmbedded bool
+	frontMatterKeys []string
+	remote          string
+	inline          bool
+	inlineMaxSize   int64
+	jobs            int
+	remoteJobs      int
+	retries         int
+	rps             float64
+	bandwidth       string
+	dedupe          bool
+	dedupeDir       string
+	layout          string
+	layoutSet       bool
+	layoutRoot      string
+	keyTemplate     string
+	manifest        bool
+	noManifest      bool
+	atomic          bool
+	keepGoing       bool
+	progress        bool
+	resume          bool
+	report          string
+	reportFile      string
+}
+
+func parseGlobalFlags(c *cli.Context) globalFlags {
+	return globalFlags{
+		types:           c.StringSlice("type"),
+		recursive:       c.Bool("recursive"),
+		config:          c.Path("config"),
+		dep2obs:         c.StringSlice("dep2obs"),
+		extractEmbedded: c.Bool("extract-embedded"),
+		frontMatterKeys: parseList(c.StringSlice("front-matter-key")),
+		remote:          c.String("remote"),
+		inline:          c.Bool("inline"),
+		inlineMaxSize:   c.Int64("inline-max-size"),
+		jobs:            c.Int("jobs"),
+		remoteJobs:      c.Int("remote-jobs"),
+		retries:         c.Int("retries"),
+		rps:             c.Float64("rps"),
+		bandwidth:       c.String("bandwidth"),
+		dedupe:          c.Bool("dedupe"),
+		dedupeDir:       c.String("dedupe-dir"),
+		layout:          c.String("layout"),
+		layoutSet:       c.IsSet("layout"),
+		layoutRoot:      c.Path("layout-root"),
+		keyTemplate:     c.String("key-template"),
+		manifest:        c.Bool("manifest"),
+		noManifest:      c.Bool("no-manifest"),
+		atomic:          c.Bool("atomic"),
+		keepGoing:       c.Bool("keep-going"),
+		progress:        c.Bool("progress"),
+		resume:          c.Bool("resume"),
+		report:          c.String("report"),
+		reportFile:      c.Path("report-file"),
+	}
+}
+
+// parseList Parse a slice flag, which is either repeated or separated by commas
+func parseList(flag []string) []string {
+	list := make([]string, 0, len(flag))
+	for _, f := range flag {
+		for _, item := range strings.Split(f, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// parseTypes Parse the '--type' flag
+func parseTypes(typeFlag []string) (map[collectable.FileType]struct{}, error) {
+	types := make(map[collectable.FileType]struct{}, len(typeFlag))
+	for _, t := range parseList(typeFlag) {
+		fileType := collectable.FileType(strings.ToLower(t))
+		if !collectable.IsDocumentType(fileType) {
+			return nil, fmt.Errorf("unsupported type: '%s'", t)
+		}
+		types[fileType] = struct{}{}
+	}
+	return types, nil
+}
+
+// parseRemotePolicy Parse the '--remote' flag
+func parseRemotePolicy(flag string) (collectable.RemotePolicy, error) {
+	switch policy := collectable.RemotePolicy(strings.ToLower(strings.TrimSpace(flag))); policy {
+	case collectable.RemoteMirror, collectable.RemoteKeep:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unsupported remote policy: '%s'", flag)
+}
+
+// parseKeyFunc Returns the KeyFunc which decides where the dependencies are
+// collected to. The key template of the flag overrides the other flags, which
+// override the key template of the config file for obs or local output
+func parseKeyFunc(flags globalFlags) (collectable.KeyFunc, error) {
+	template, err := parseKeyTemplate(flags)
+	if err != nil {
+		return nil, err
+	}
+	if template != "" {
+		return collectable.NewTemplateKey(template)
+	}
+	if flags.dedupe {
+		return collectable.NewContentAddresser(flags.dedupeDir).Key, nil
+	}
+	switch flags.layout {
+	case "", "flat":
+		return collectable.NewKeyAssigner(collectable.DependencyKey).Key, nil
+	case "preserve":
+		return collectable.NewKeyAssigner(collectable.NewLayoutKey(flags.layoutRoot)).Key, nil
+	}
+	return nil, fmt.Errorf("unknown layout '%s', should be 'flat' or 'preserve'", flags.layout)
+}
+
+// parseKeyTemplate Returns the key template of the flag, or of the config file
+// for the output of the dependencies unless '--dedupe' or '--layout' is set.
+// Empty if neither is used
+func parseKeyTemplate(flags globalFlags) (string, error) {
+	if flags.keyTemplate != "" || flags.dedupe || flags.layoutSet || !utils.IsFileExist(flags.config) {
+		return flags.keyTemplate, nil
+	}
+	local, obs, err := conf.GetKeyTemplatesFromConfigFile(flags.config)
+	if err != nil {
+		return "", err
+	}
+	if len(flags.dep2obs) > 0 {
+		return obs, nil
+	}
+	return local, nil
+}
+
+// parseRateLimits Returns the rate limits of http downloads and of the bucket.
+// The flags override the 'LIMITS' section of the config file, and the 'OBS'
+// section overrides both for the bucket
+func parseRateLimits(flags globalFlags) (limits, obsLimits conf.RateLimits, err error) {
+	if utils.IsFileExist(flags.config) {
+		if limits, obsLimits, err = conf.GetRateLimitsFromConfigFile(flags.config); err != nil {
+			return
+		}
+	}
+	flagLimits := conf.RateLimits{RequestsPerSecond: flags.rps}
+	if flags.bandwidth != "" {
+		if flagLimits.BytesPerSecond, err = conf.ParseBytes(flags.bandwidth); err != nil {
+			return
+		}
+	}
+	limits = limits.Merge(flagLimits)
+	obsLimits = limits.Merge(obsLimits)
 	return
 }
 
-func getCollectableFileRecursively(dirname string) (collectableFiles []collectable.FileOperator, err error) {
+// documentTypes Returns all the types of documents which can be collected
+func documentTypes() map[collectable.FileType]struct{} {
+	types := make(map[collectable.FileType]struct{})
+	for _, fileType := range collectable.DocumentTypes() {
+		types[fileType] = struct{}{}
+	}
+	return types
+}
+
+// newCollectableFile Create a collectable file for the document at path
+// according to its extension. Returns false if the document is not one of
+// types
+func newCollectableFile(path string, types map[collectable.FileType]struct{}, options ...collectable.Option) (collectable.FileOperator, bool) {
+	if _, ok := types[collectable.FileTypeOf(path)]; !ok {
+		return nil, false
+	}
+	return collectable.NewFile("", path, options...), true
+}
+
+func getCollectableFileRecursively(dirname string, types map[collectable.FileType]struct{}, options ...collectable.Option) (collectableFiles []collectable.FileOperator, err error) {
 	collectableFiles = []collectable.FileOperator{}
 	err = filepath.Walk(dirname, func(path string, info os.FileInfo, err error) error {
-		if filepath.Ext(path) != ".md" {
+		collectableFile, ok := newCollectableFile(path, types, options...)
+		if !ok {
 			return nil
 		}
-		collectableFiles = append(collectableFiles, collectable.NewMarkdownFile("", path))
+		collectableFiles = append(collectableFiles, collectableFile)
 		return nil
 	})
 	return collectableFiles, err
 }
 
-func getCollectorsRecursively(source, destination string, generator collector.Generator, uriMapper collectable.URIMapper) (collectors []collector.Collector, err error) {
+// getCollectorsRecursively Returns the collectors of the documents under
+// source, and the absolute paths of the documents
+func getCollectorsRecursively(source, destination string, types map[collectable.FileType]struct{}, generator collector.Generator, depMapper collectable.DependencyMapper, collectorOptions []collector.Option, options ...collectable.Option) (collectors []collector.Collector, sources []string, err error) {
 	collectors = []collector.Collector{}
+	sources = []string{}
 	sourceAbsolute, err := filepath.Abs(source)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-		if filepath.Ext(path) != ".md" {
+		collectableFile, ok := newCollectableFile(path, types, options...)
+		if !ok {
 			return nil
 		}
-		collectableFile := collectable.NewMarkdownFile("", path)
 		pathAbsolute, err := filepath.Abs(path)
 		if err != nil {
 			return nil
@@ -75,19 +255,21 @@ func getCollectorsRecursively(source, destination string, generator collector.Ge
 		key := strings.TrimPrefix(pathAbsolute, sourceAbsolute)
 		key = strings.TrimPrefix(key, "\\")
 		key = strings.TrimPrefix(key, "/")
-		c, err := collector.GetLocalCollectorGenerator(uriMapper)(
+		c, err := collector.GetMappedLocalCollectorGenerator(depMapper)(
 			collectableFile,
 			destination,
 			key,
 			generator,
+			collectorOptions...,
 		)
 		if err != nil {
 			return err
 		}
 		collectors = append(collectors, c)
+		sources = append(sources, pathAbsolute)
 		return nil
 	})
-	return collectors, err
+	return collectors, sources, err
 }
 
 func validateDir(path string) string {
@@ -116,10 +298,36 @@ func validateFile(path string) string {
 	return ""
 }
 
-func copyMDs(c *cli.Context, source, destination string) (err error) {
+// copyMDs Collect the documents at source to destination, and record them in
+// the manifest of the repository at root. The repository is the destination
+// directory if root is empty
+func copyMDs(c *cli.Context, source, destination, root string) (err error) {
 	fail := 0
 	success := 0
-	_, recursive, config, dep2obsFlag := parseGlobalFlags(c)
+	flags := parseGlobalFlags(c)
+	recursive := flags.recursive
+	remotePolicy, err := parseRemotePolicy(flags.remote)
+	if err != nil {
+		return err
+	}
+	if flags.inline {
+		// Every dependency is embedded with --inline, so the remote ones are
+		// downloaded as well, and the ones too large to embed are mirrored
+		remotePolicy = collectable.RemoteMirror
+	}
+	options := []collectable.Option{
+		collectable.WithExtractEmbedded(flags.extractEmbedded),
+		collectable.WithFrontMatterKeys(flags.frontMatterKeys...),
+		collectable.WithRemotePolicy(remotePolicy),
+	}
+	reportFormat, err := parseReportFormat(flags.report)
+	if err != nil {
+		return err
+	}
+	types, err := parseTypes(flags.types)
+	if err != nil {
+		return err
+	}
 
 	if recursive {
 		if errStr := validateDir(source); errStr != "" {
@@ -131,12 +339,42 @@ func copyMDs(c *cli.Context, source, destination string) (err error) {
 		}
 	}
 
+	var retries int64
+	retryPolicy := utils.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = flags.retries + 1
+	retryPolicy.OnRetry = func(attempt int, err error) {
+		atomic.AddInt64(&retries, 1)
+		log.Printf("Retry (attempt %d) after error: %s\n", attempt, err.Error())
+	}
+
+	limits, obsLimits, err := parseRateLimits(flags)
+	if err != nil {
+		return err
+	}
+	httpLimiter := utils.NewRateLimiter(limits.RequestsPerSecond, limits.BytesPerSecond)
+	options = append(options, collectable.WithHTTPDownloader(utils.NewHTTPDownloader(retryPolicy, httpLimiter)))
+
+	keyFunc, err := parseKeyFunc(flags)
+	if err != nil {
+		return err
+	}
+
+	// The collectors stop on SIGINT or SIGTERM, and the documents left are
+	// saved to be resumed
+	ctx, interrupted, stop := withInterrupt(context.Background())
+	defer stop()
+	options = append(options, collectable.WithContext(ctx))
+
 	var depCollectorGenerator = collector.LocalCollectorGenerator
-	var depURIMapper = collectable.LocalURIMapper
-	if dep2obsFlag != nil && len(dep2obsFlag) > 0 {
-		if bucket, err := conf.GetBucketFromConfigFile(config); err == nil {
+	var depMapper = collectable.NewLocalDependencyMapper(keyFunc)
+	if flags.dep2obs != nil && len(flags.dep2obs) > 0 {
+		if bucket, err := conf.GetBucketFromConfigFile(flags.config); err == nil {
+			if limiter := utils.NewRateLimiter(obsLimits.RequestsPerSecond, obsLimits.BytesPerSecond); limiter != nil {
+				bucket = provider.NewRateLimitedBucket(ctx, bucket, limiter)
+			}
+			bucket = provider.NewRetryBucket(ctx, bucket, retryPolicy)
 			depCollectorGenerator = collector.GetOBSCollectorGenerator(bucket)
-			if depURIMapper, err = collectable.GetOBSURIMapper(bucket); err != nil {
+			if depMapper, err = collectable.NewOBSDependencyMapper(bucket, keyFunc); err != nil {
 				return err
 			}
 		} else {
@@ -144,49 +382,205 @@ func copyMDs(c *cli.Context, source, destination string) (err error) {
 		}
 	}
 
+	// Dependencies sharing a key, which are the ones with the same content
+	// with '--dedupe', are collected once
+	if flags.dedupe {
+		depCollectorGenerator = collector.GetDedupeCollectorGenerator(ctx, depCollectorGenerator)
+	}
+
+	if flags.inline {
+		inliner, err := collectable.NewInliner(flags.inlineMaxSize, depMapper)
+		if err != nil {
+			return err
+		}
+		depCollectorGenerator = collector.GetInlineCollectorGenerator(inliner, depCollectorGenerator)
+		depMapper = inliner.Map
+	}
+
+	collectorOptions := []collector.Option{
+		collector.WithScheduler(collector.NewScheduler(flags.jobs, flags.remoteJobs)),
+		collector.WithKeyFunc(keyFunc),
+		collector.WithKeepGoing(flags.keepGoing),
+	}
+	// The documents collected to the repository are recorded unless
+	// '--no-manifest', and the copied ones only with '--manifest'
+	recordManifest := flags.manifest || (root != "" && !flags.noManifest)
+	if root == "" {
+		root = destination
+		if !recursive {
+			root = filepath.Dir(destination)
+		}
+	}
+	var m *manifest.Manifest
+	if recordManifest {
+		if m, err = manifest.Open(root); err != nil {
+			return err
+		}
+		collectorOptions = append(collectorOptions, collector.WithManifest(m))
+	}
+	if flags.atomic {
+		collectorOptions = append(collectorOptions, collector.WithJournal(collector.NewJournal()))
+	}
+	var display *progress
+	if flags.progress {
+		display = newProgress(os.Stderr, 0)
+		collectorOptions = append(collectorOptions, collector.WithObserver(display.observe))
+	}
+	var report *runReport
+	if reportFormat != "" {
+		report = newRunReport()
+		collectorOptions = append(collectorOptions, collector.WithObserver(report.observe))
+	}
+
 	collectors := []collector.Collector{}
+	sources := []string{}
 	if recursive {
-		if collectors, err = getCollectorsRecursively(source, destination, depCollectorGenerator, depURIMapper); err != nil {
+		if collectors, sources, err = getCollectorsRecursively(source, destination, types, depCollectorGenerator, depMapper, collectorOptions, options...); err != nil {
 			return err
 		}
 	} else {
-		collectableFile := collectable.NewMarkdownFile("", source)
-		c, err := collector.GetLocalCollectorGenerator(depURIMapper)(
+		// Files of the document types not selected by '--type' are refused
+		// as in the recursive mode, and the ones of unknown types are
+		// collected as markdown files
+		collectableFile, ok := newCollectableFile(source, types, options...)
+		if !ok {
+			if fileType := collectable.FileTypeOf(source); collectable.IsDocumentType(fileType) {
+				return fmt.Errorf("'%s' is a %s document, which is not selected by '--type'", source, fileType)
+			}
+			collectableFile = collectable.NewMarkdownFile("", source, options...)
+		}
+		c, err := collector.GetMappedLocalCollectorGenerator(depMapper)(
 			collectableFile,
 			filepath.Dir(destination),
 			filepath.Base(destination),
 			depCollectorGenerator,
+			collectorOptions...,
 		)
 		if err != nil {
 			return err
 		}
 		collectors = append(collectors, c)
+		sources = append(sources, absPath(source))
 	}
 
-	cases := make([]reflect.SelectCase, len(collectors))
-	for i := 0; i < len(cases); i++ {
-		complete := collectors[i].Collect(context.Background())
-		cases[i] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(complete),
+	statePath := resumeStatePath(root)
+	if flags.resume {
+		if collectors, sources, err = resumeCollectors(statePath, source, destination, collectors, sources); err != nil {
+			return err
 		}
 	}
 
-	for remaining := len(cases); remaining > 0; remaining-- {
-		chosen, value, _ := reflect.Select(cases)
-		if value.Interface() != nil {
-			err = value.Interface().(error)
-		}
+	if display != nil {
+		display.documents = len(collectors)
+		go display.run()
+	}
+
+	type result struct {
+		index int
+		err   error
+	}
+	results := make(chan result, len(collectors))
+	for i, c := range collectors {
+		go func(index int, complete <-chan error) {
+			results <- result{index: index, err: <-complete}
+		}(i, c.Collect(ctx))
+	}
+
+	// With --keep-going the errors are reported together at the end, rather
+	// than interleaved with the logs
+	errs := make([]*collector.FileError, 0)
+	remaining := make([]string, 0)
+	for range collectors {
+		r := <-results
+		err := r.err
 		if err != nil {
-			log.Printf(err.Error())
+			remaining = append(remaining, sources[r.index])
+			if flags.keepGoing {
+				errs = append(errs, collector.FileErrors(err)...)
+			} else {
+				log.Printf(err.Error())
+			}
 			fail++
 		} else {
 			success++
 		}
-		cases[chosen].Chan = reflect.ValueOf(nil)
+	}
+	if display != nil {
+		display.stop()
+	}
+	printErrorReport(os.Stderr, errs)
+	if m != nil {
+		if err := m.Save(); err != nil {
+			return err
+		}
+	}
+
+	if interrupted() {
+		state := &resumeState{
+			Source:        absPath(source),
+			Destination:   absPath(destination),
+			InterruptedAt: time.Now(),
+			Remaining:     remaining,
+		}
+		sort.Strings(state.Remaining)
+		if err := state.save(statePath); err != nil {
+			return err
+		}
+		if report != nil {
+			if err := writeRunReport(report, reportFormat, flags.reportFile, atomic.LoadInt64(&retries)); err != nil {
+				return err
+			}
+		}
+		log.Printf("Interrupted! Total: %d, success: %d, failed or stopped: %d, retries: %d\n", fail+success, success, fail, atomic.LoadInt64(&retries))
+		return fmt.Errorf("interrupted with %d documents left, which are saved in '%s', run again with --resume to continue", len(remaining), statePath)
+	}
+	if err := removeResumeState(statePath); err != nil {
+		return err
 	}
 
-	log.Printf("Finished! Total: %d, success: %d, failed: %d\n", fail+success, success, fail)
+	if report != nil {
+		return writeRunReport(report, reportFormat, flags.reportFile, atomic.LoadInt64(&retries))
+	}
+	log.Printf("Finished! Total: %d, success: %d, failed: %d, retries: %d\n", fail+success, success, fail, atomic.LoadInt64(&retries))
 
 	return nil
 }
+
+// resumeCollectors Returns the collectors of the documents left by the
+// interrupted run saved at statePath, or all the collectors if there is none
+func resumeCollectors(statePath, source, destination string, collectors []collector.Collector, sources []string) ([]collector.Collector, []string, error) {
+	state, err := loadResumeState(statePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state == nil {
+		log.Printf("No interrupted run to resume in '%s', collecting all the documents\n", statePath)
+		return collectors, sources, nil
+	}
+	if err := state.match(absPath(source), absPath(destination)); err != nil {
+		return nil, nil, err
+	}
+	left := make(map[string]struct{}, len(state.Remaining))
+	for _, remaining := range state.Remaining {
+		left[remaining] = struct{}{}
+	}
+	resumedCollectors := make([]collector.Collector, 0, len(state.Remaining))
+	resumedSources := make([]string, 0, len(state.Remaining))
+	for i, c := range collectors {
+		if _, ok := left[sources[i]]; ok {
+			resumedCollectors = append(resumedCollectors, c)
+			resumedSources = append(resumedSources, sources[i])
+		}
+	}
+	log.Printf("Resuming %d of %d documents left by the run interrupted at %s\n",
+		len(resumedCollectors), len(collectors), state.InterruptedAt.Format(time.RFC3339))
+	return resumedCollectors, resumedSources, nil
+}
+
+// absPath Returns the absolute path of path, or path itself if it fails
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
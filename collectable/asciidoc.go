@@ -0,0 +1,219 @@
+package collectable
+
+import (
+	"path/filepath"
+	"regexp"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+var (
+	asciiDocImageBlockRegex = regexp.MustCompile(`(?m)^image::(?P<uri>[^\[\s]+)\[`)
+	asciiDocIncludeRegex    = regexp.MustCompile(`(?m)^include::(?P<uri>[^\[\s]+)\[`)
+	asciiDocInlineRegex     = regexp.MustCompile(`\bimage:(?P<uri>[^:\[\s][^\[\s]*)\[`)
+	asciiDocImagesDirRegex  = regexp.MustCompile(`(?m)^:imagesdir(!?):[ \t]*(.*?)[ \t]*$`)
+)
+
+func init() {
+	// '.asc' is left out, since it is usually an armored PGP signature or key
+	RegisterDocument(AsciiDoc, func(parent, uri string, options ...Option) FileOperator {
+		return NewAsciiDocFile(parent, uri, options...)
+	}, ".adoc", ".asciidoc")
+}
+
+// AsciiDocFile Collectable files which is AsciiDoc format. Images referred by
+// block and inline 'image' macros and files included by 'include' directives
+// are its dependencies.
+//
+// Included files are resolved relative to the file including them, while
+// images are resolved relative to the 'imagesdir' attribute under the
+// directory of the main document, which applies to the included files as well.
+// Images under an 'imagesdir' which is an url are left as they are
+type AsciiDocFile struct {
+	*textFile
+	// root is the main document, nil if the file is the main document
+	root *AsciiDocFile
+	// imagesDir is the 'imagesdir' in effect where the file is included
+	imagesDir string
+	// objectKey is the object key the file is collected to
+	objectKey string
+}
+
+// asciiDocReference A reference found in AsciiDoc source
+type asciiDocReference struct {
+	reference
+	// image is true if the reference is resolved against imagesDir
+	image     bool
+	imagesDir string
+}
+
+// NewAsciiDocFile Create a AsciiDocFile object which is a collectable file for
+// AsciiDoc file
+func NewAsciiDocFile(parent, uri string, options ...Option) *AsciiDocFile {
+	return newAsciiDocFile(parent, uri, nil, "", options...)
+}
+
+func newAsciiDocFile(parent, uri string, root *AsciiDocFile, imagesDir string, options ...Option) *AsciiDocFile {
+	return &AsciiDocFile{
+		textFile:  newTextFile(parent, uri, AsciiDoc, nil, options...),
+		root:      root,
+		imagesDir: imagesDir,
+	}
+}
+
+// FindDependencies Returns the files referred in the AsciiDoc source
+func (a *AsciiDocFile) FindDependencies() ([]FileOperator, error) {
+	if err := a.FileError(); err != nil {
+		return nil, err
+	}
+
+	refs := a.references()
+	dependencies := make([]FileOperator, 0, len(refs))
+	found := make(map[string]struct{}, len(refs))
+	for _, ref := range refs {
+		if _, ok := found[ref.path]; ok {
+			continue
+		}
+		found[ref.path] = struct{}{}
+		dependencies = append(dependencies, a.dependency(ref))
+	}
+	return dependencies, nil
+}
+
+// dependency Returns the dependency of the reference, included files share
+// the main document with the file and inherit the 'imagesdir' in effect
+func (a *AsciiDocFile) dependency(ref asciiDocReference) FileOperator {
+	return a.dependencies.get(ref.path, func() FileOperator {
+		if !ref.image && FileTypeOf(ref.path) == AsciiDoc {
+			return newAsciiDocFile(a.uri, ref.path, a.mainFile(), ref.imagesDir, a.configs.dependencyOptions(a.uri)...)
+		}
+		return NewFile(a.uri, ref.path, a.configs.dependencyOptions(a.uri)...)
+	})
+}
+
+// ReplaceDependencyURIs Replace the uris of the dependencies by the uris
+// mapped by mapper
+func (a *AsciiDocFile) ReplaceDependencyURIs(base, objectKey string, mapper URIMapper) error {
+	return a.ReplaceDependencies(base, objectKey, mapper.DependencyMapper())
+}
+
+// ReplaceDependencies Replace the referred uris in the AsciiDoc source. Images
+// are referred relative to the 'imagesdir' under the collected main document
+func (a *AsciiDocFile) ReplaceDependencies(base, objectKey string, mapper DependencyMapper) error {
+	if err := a.FileError(); err != nil {
+		return err
+	}
+	a.objectKey = objectKey
+	mainKey := a.mainFile().objectKey
+
+	refs := a.references()
+	asciiDocRefs := make(map[int]asciiDocReference, len(refs))
+	plainRefs := make([]reference, len(refs))
+	for i, ref := range refs {
+		asciiDocRefs[ref.start] = ref
+		plainRefs[i] = ref.reference
+	}
+
+	a.buffer = replaceReferences(a.buffer, plainRefs, func(ref reference) []byte {
+		asciiDocRef := asciiDocRefs[ref.start]
+		newURI := string(mapper(a.dependency(asciiDocRef), base, objectKey))
+		if asciiDocRef.image && !schemeRegex.MatchString(newURI) && !filepath.IsAbs(newURI) {
+			// The mapped uri is relative to the file, while the image is
+			// resolved against the imagesdir under the main document
+			target := filepath.Join(base, filepath.Dir(objectKey), newURI)
+			imagesDir := filepath.Join(base, filepath.Dir(mainKey), asciiDocRef.imagesDir)
+			if filepath.IsAbs(asciiDocRef.imagesDir) {
+				imagesDir = asciiDocRef.imagesDir
+				if abs, err := filepath.Abs(target); err == nil {
+					target = abs
+				}
+			}
+			if rel, err := filepath.Rel(imagesDir, target); err == nil {
+				newURI = rel
+			}
+		}
+		if isEscaped(ref.uri) {
+			return escapeLocalURI([]byte(newURI))
+		}
+		return []byte(filepath.ToSlash(newURI))
+	})
+	return nil
+}
+
+func (a *AsciiDocFile) mainFile() *AsciiDocFile {
+	if a.root != nil {
+		return a.root
+	}
+	return a
+}
+
+// imagesDirAt Returns the 'imagesdir' in effect at the position of the source
+func (a *AsciiDocFile) imagesDirAt(pos int) string {
+	imagesDir := a.imagesDir
+	for _, match := range asciiDocImagesDirRegex.FindAllSubmatchIndex(a.buffer, -1) {
+		if match[0] > pos {
+			break
+		}
+		imagesDir = ""
+		if match[2] == match[3] {
+			imagesDir = string(a.buffer[match[4]:match[5]])
+		}
+	}
+	return imagesDir
+}
+
+// references Find all the references in the AsciiDoc source, the ones to
+// remote files are left out unless they are mirrored
+func (a *AsciiDocFile) references() []asciiDocReference {
+	refs := make([]asciiDocReference, 0)
+	add := func(match []int, image bool) {
+		start, end := match[2], match[3]
+		written := string(a.buffer[start:end])
+		imagesDir := a.imagesDirAt(start)
+		if utils.IsHTTPURI(written) {
+			if a.configs.mirrorRemote() {
+				refs = append(refs, asciiDocReference{
+					reference: reference{start: start, end: end, uri: written, path: written},
+					image:     image,
+					imagesDir: imagesDir,
+				})
+			}
+			return
+		}
+
+		refURI := trimQueryAndFragment(written)
+		parent := a.uri
+		if image {
+			if schemeRegex.MatchString(imagesDir) && filepath.VolumeName(imagesDir) == "" {
+				return
+			}
+			// Images are resolved as if they were referred by a file in
+			// imagesdir under the directory of the main document
+			dir := imagesDir
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(filepath.Dir(a.mainFile().uri), dir)
+			}
+			parent = filepath.Join(dir, filepath.Base(a.uri))
+		}
+		p, ok := resolveLocalReference(parent, refURI)
+		if !ok || p == a.uri || a.configs.isAncestor(p) {
+			return
+		}
+		refs = append(refs, asciiDocReference{
+			reference: reference{start: start, end: start + len(refURI), uri: refURI, path: p},
+			image:     image,
+			imagesDir: imagesDir,
+		})
+	}
+
+	for _, match := range asciiDocImageBlockRegex.FindAllSubmatchIndex(a.buffer, -1) {
+		add(match, true)
+	}
+	for _, match := range asciiDocInlineRegex.FindAllSubmatchIndex(a.buffer, -1) {
+		add(match, true)
+	}
+	for _, match := range asciiDocIncludeRegex.FindAllSubmatchIndex(a.buffer, -1) {
+		add(match, false)
+	}
+	return refs
+}
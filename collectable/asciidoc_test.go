@@ -0,0 +1,101 @@
+package collectable
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsciiDocFile(t *testing.T) {
+	dir := t.TempDir()
+	adocPath := filepath.Join(dir, "book.adoc")
+	writeTestFile(t, adocPath, `= Book
+
+image::img/cover.png[Cover,300]
+
+Click image:icons/play.png[Play] to start.
+
+include::chapters/intro.adoc[]
+`)
+	writeTestFile(t, filepath.Join(dir, "chapters", "intro.adoc"), "image::diagram.png[]\n")
+
+	var collectableFile FileOperator = NewAsciiDocFile("", adocPath)
+	require.Nil(t, collectableFile.FileError())
+	require.Equal(t, AsciiDoc, collectableFile.GetFileType())
+
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	uris := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		uris = append(uris, dependency.GetURI())
+	}
+	require.ElementsMatch(t, []string{
+		filepath.Join(dir, "img", "cover.png"),
+		filepath.Join(dir, "icons", "play.png"),
+		filepath.Join(dir, "chapters", "intro.adoc"),
+	}, uris)
+
+	for _, dependency := range dependencies {
+		if dependency.GetFileType() != AsciiDoc {
+			continue
+		}
+		nested, err := dependency.FindDependencies()
+		require.Nil(t, err)
+		require.Equal(t, 1, len(nested))
+		// Images in included files are resolved against the main document
+		require.Equal(t, filepath.Join(dir, "diagram.png"), nested[0].GetURI())
+	}
+
+	err = collectableFile.ReplaceDependencyURIs(dir, "book.adoc", LocalURIMapper)
+	require.Nil(t, err)
+	require.Equal(t, `= Book
+
+image::book_medias/cover.png[Cover,300]
+
+Click image:book_medias/play.png[Play] to start.
+
+include::book_medias/intro.adoc[]
+`, string(collectableFile.(*AsciiDocFile).buffer))
+}
+
+func TestAsciiDocFile_imagesDir(t *testing.T) {
+	dir := t.TempDir()
+	adocPath := filepath.Join(dir, "book.adoc")
+	writeTestFile(t, adocPath, `= Book
+:imagesdir: images
+
+image::cover.png[]
+
+include::chapters/intro.adoc[]
+`)
+	writeTestFile(t, filepath.Join(dir, "chapters", "intro.adoc"), "image::diagram.png[]\n")
+	writeTestFile(t, filepath.Join(dir, "images", "cover.png"), "cover")
+	writeTestFile(t, filepath.Join(dir, "images", "diagram.png"), "diagram")
+
+	adoc := NewAsciiDocFile("", adocPath)
+	deps, err := adoc.FindDependencies()
+	require.Nil(t, err)
+	require.Len(t, deps, 2)
+	require.Equal(t, filepath.Join(dir, "images", "cover.png"), deps[0].GetURI())
+	require.Equal(t, filepath.Join(dir, "chapters", "intro.adoc"), deps[1].GetURI())
+	nested, err := deps[1].FindDependencies()
+	require.Nil(t, err)
+	require.Len(t, nested, 1)
+	require.Equal(t, filepath.Join(dir, "images", "diagram.png"), nested[0].GetURI())
+
+	// The collected images are referred relative to the imagesdir under the
+	// collected main document
+	mapper := NewLocalDependencyMapper(DependencyKey)
+	require.Nil(t, adoc.ReplaceDependencies(dir, "book.adoc", mapper))
+	require.Equal(t, `= Book
+:imagesdir: images
+
+image::../book_medias/cover.png[]
+
+include::book_medias/intro.adoc[]
+`, string(adoc.buffer))
+	intro := deps[1].(*AsciiDocFile)
+	require.Nil(t, intro.ReplaceDependencies(dir, filepath.Join("book_medias", "intro.adoc"), mapper))
+	require.Equal(t, "image::../book_medias/intro_medias/diagram.png[]\n", string(intro.buffer))
+}
@@ -1,6 +1,10 @@
 package collectable
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
 	"time"
 
 	"github.com/slipfre/imgmd/provider"
@@ -28,6 +32,74 @@ type FileOperator interface {
 // URIMapper Map the uri
 type URIMapper func(fileType FileType, originURI []byte, base, objectKey string) []byte
 
+// DependencyMapper Map the dependency to the uri which refers to it in the file
+// collected to base/objectKey
+type DependencyMapper func(dep FileOperator, base, objectKey string) []byte
+
+// DependencyMapper Returns a DependencyMapper which maps the type and the uri
+// of the dependency by m
+func (m URIMapper) DependencyMapper() DependencyMapper {
+	if m == nil {
+		return nil
+	}
+	return func(dep FileOperator, base, objectKey string) []byte {
+		return m(dep.GetFileType(), []byte(dep.GetURI()), base, objectKey)
+	}
+}
+
+// DependencyReplacer Files whose dependencies can be mapped by a
+// DependencyMapper, which all the files in this package are
+type DependencyReplacer interface {
+	ReplaceDependencies(base, objectKey string, mapper DependencyMapper) error
+}
+
+// Opener Files whose content can be read, which all the files in this package
+// are
+type Opener interface {
+	Open() (io.ReadCloser, error)
+}
+
+// Fetcher Files which are downloaded from remote, such as RemoteFile. Fetch
+// downloads the file ahead of its first use, and stops once ctx is cancelled
+type Fetcher interface {
+	Fetch(ctx context.Context) error
+}
+
+// ReplaceDependencies Replace the uris of the dependencies of cf by mapper. For
+// files not implementing DependencyReplacer, the dependencies are created from
+// the uris passed to their URIMapper
+func ReplaceDependencies(cf FileOperator, base, objectKey string, mapper DependencyMapper) error {
+	if replacer, ok := cf.(DependencyReplacer); ok {
+		return replacer.ReplaceDependencies(base, objectKey, mapper)
+	}
+	return cf.ReplaceDependencyURIs(base, objectKey, func(fileType FileType, originURI []byte, base, objectKey string) []byte {
+		uri := string(originURI)
+		if path, ok := resolveLocalReference(cf.GetURI(), uri); ok {
+			uri = path
+		}
+		return mapper(NewFile(cf.GetURI(), uri), base, objectKey)
+	})
+}
+
+// Open Returns a reader of the content of cf, error if cf does not implement
+// Opener
+func Open(cf FileOperator) (io.ReadCloser, error) {
+	opener, ok := cf.(Opener)
+	if !ok {
+		return nil, fmt.Errorf("'%s' can not be read", cf.GetURI())
+	}
+	return opener.Open()
+}
+
+// FileName Returns the name of the file collected for the collectable file,
+// which is the base of its uri unless the file names itself
+func FileName(cf FileOperator) string {
+	if named, ok := cf.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return filepath.Base(cf.GetURI())
+}
+
 // FileAttrs Attributes of the collectable file
 type FileAttrs struct {
 	parent      string
@@ -56,6 +128,20 @@ const (
 	Leaf FileType = "leaf"
 	// Markdown Stand for Markdown files
 	Markdown FileType = "markdown"
+	// CSS Stand for stylesheets
+	CSS FileType = "css"
+	// SVG Stand for svg images
+	SVG FileType = "svg"
+	// IPYNB Stand for jupyter notebooks
+	IPYNB FileType = "ipynb"
+	// RST Stand for reStructuredText files
+	RST FileType = "rst"
+	// AsciiDoc Stand for AsciiDoc files
+	AsciiDoc FileType = "asciidoc"
+	// TeX Stand for LaTeX source files
+	TeX FileType = "tex"
+	// Org Stand for Emacs Org files
+	Org FileType = "org"
 	// None Stand for a file which is not exist
 	None FileType = "none"
 )
@@ -88,13 +174,14 @@ func (f *FileAttrs) GetUpdatedTime() (*time.Time, error) {
 	return f.updatedTime, f.err
 }
 
-// IsUpdatedSince For local file, Returns true if the file has updated.
+// IsUpdatedSince For local file, Returns true if the file has updated since
+// the time, or if either time is unknown
 func (f *FileAttrs) IsUpdatedSince(time *time.Time) (bool, error) {
 	if f.err != nil {
 		return false, f.err
 	}
-	if f.updatedTime == nil {
+	if f.updatedTime == nil || time == nil {
 		return true, nil
 	}
-	return time.After(*f.updatedTime), nil
+	return f.updatedTime.After(*time), nil
 }
@@ -3,6 +3,7 @@ package collectable
 import (
 	"context"
 	"errors"
+	"io"
 
 	"github.com/slipfre/imgmd/provider"
 )
@@ -37,6 +38,11 @@ func WithCancel(ctx context.Context, cf FileOperator) (FileOperator, error) {
 	}, nil
 }
 
+// Name Returns the name of the collected file
+func (c *CancellableFile) Name() string {
+	return FileName(c.collectableFile)
+}
+
 // FindDependencies Returns all the dependencies
 func (c *CancellableFile) FindDependencies() ([]FileOperator, error) {
 	if yes, err := c.cancelled(); yes {
@@ -53,6 +59,22 @@ func (c *CancellableFile) ReplaceDependencyURIs(base, objectKey string, mapper U
 	return c.collectableFile.ReplaceDependencyURIs(base, objectKey, mapper)
 }
 
+// ReplaceDependencies Replaces all the dependencies in the file
+func (c *CancellableFile) ReplaceDependencies(base, objectKey string, mapper DependencyMapper) error {
+	if yes, err := c.cancelled(); yes {
+		return err
+	}
+	return ReplaceDependencies(c.collectableFile, base, objectKey, mapper)
+}
+
+// Open Returns a reader of the file
+func (c *CancellableFile) Open() (io.ReadCloser, error) {
+	if yes, err := c.cancelled(); yes {
+		return nil, err
+	}
+	return Open(c.collectableFile)
+}
+
 // To Write the file to a new place
 func (c *CancellableFile) To(uri string) error {
 	if yes, err := c.cancelled(); yes {
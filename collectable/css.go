@@ -0,0 +1,28 @@
+package collectable
+
+import "regexp"
+
+var (
+	cssURLRegex    = regexp.MustCompile(`url\(\s*(?:"(?P<uri>[^"]*)"|'(?P<uri>[^']*)'|(?P<uri>[^'")\s]+))\s*\)`)
+	cssImportRegex = regexp.MustCompile(`@import\s+(?:"(?P<uri>[^"]*)"|'(?P<uri>[^']*)')`)
+)
+
+func init() {
+	Register(CSS, func(parent, uri string, options ...Option) FileOperator {
+		return NewCSSFile(parent, uri, options...)
+	}, ".css")
+}
+
+// CSSFile Collectable files which is stylesheet. Fonts, images and imported
+// stylesheets referred by 'url(...)' and '@import' are its dependencies
+type CSSFile struct {
+	*textFile
+}
+
+// NewCSSFile Create a CSSFile object which is a collectable file for
+// stylesheet
+func NewCSSFile(parent, uri string, options ...Option) *CSSFile {
+	return &CSSFile{
+		textFile: newTextFile(parent, uri, CSS, regexResourceFinder(cssURLRegex, cssImportRegex), options...),
+	}
+}
@@ -0,0 +1,70 @@
+package collectable
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSSFile(t *testing.T) {
+	dir := t.TempDir()
+	cssPath := filepath.Join(dir, "theme", "style.css")
+	writeTestFile(t, cssPath, `@import "base.css";
+@import url(https://fonts.example.com/css?family=Roboto);
+@font-face {
+  src: url('fonts/font.woff2') format('woff2'), url(fonts/font.eot?#iefix);
+}
+body { background: url("img/bg%20dark.png"); }
+.icon { background: url(data:image/png;base64,AAAA); }
+`)
+	writeTestFile(t, filepath.Join(dir, "theme", "base.css"), `h1 { background: url(../img/h1.png); }`)
+
+	var collectableFile FileOperator = NewCSSFile("", cssPath)
+	require.Nil(t, collectableFile.FileError())
+	require.Equal(t, CSS, collectableFile.GetFileType())
+
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	uris := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		require.Equal(t, cssPath, dependency.GetParent())
+		uris = append(uris, dependency.GetURI())
+	}
+	require.ElementsMatch(t, []string{
+		filepath.Join(dir, "theme", "base.css"),
+		filepath.Join(dir, "theme", "fonts", "font.woff2"),
+		filepath.Join(dir, "theme", "fonts", "font.eot"),
+		filepath.Join(dir, "theme", "img", "bg dark.png"),
+	}, uris)
+
+	for _, dependency := range dependencies {
+		if dependency.GetURI() == filepath.Join(dir, "theme", "base.css") {
+			require.Equal(t, CSS, dependency.GetFileType())
+			nested, err := dependency.FindDependencies()
+			require.Nil(t, err)
+			require.Equal(t, 1, len(nested))
+			require.Equal(t, filepath.Join(dir, "img", "h1.png"), nested[0].GetURI())
+		} else {
+			require.Equal(t, Leaf, dependency.GetFileType())
+		}
+	}
+
+	err = collectableFile.ReplaceDependencyURIs(dir, "theme/style.css", LocalURIMapper)
+	require.Nil(t, err)
+
+	targetPath := filepath.Join(dir, "out", "style.css")
+	require.Nil(t, collectableFile.To(targetPath))
+	require.FileExists(t, targetPath)
+
+	collected := NewCSSFile("", targetPath)
+	require.Nil(t, collected.FileError())
+	require.Equal(t, `@import "style_medias/base.css";
+@import url(https://fonts.example.com/css?family=Roboto);
+@font-face {
+  src: url('style_medias/font.woff2') format('woff2'), url(style_medias/font.eot?#iefix);
+}
+body { background: url("style_medias/bg%20dark.png"); }
+.icon { background: url(data:image/png;base64,AAAA); }
+`, string(collected.buffer))
+}
@@ -0,0 +1,70 @@
+package collectable
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/slipfre/imgmd/provider"
+	"github.com/slipfre/imgmd/utils"
+)
+
+// EmbeddedFile Collectable file whose content is embedded in another file,
+// such as a base64 encoded image. It has no dependencies
+type EmbeddedFile struct {
+	*FileAttrs
+	data []byte
+}
+
+// NewEmbeddedFile Create a EmbeddedFile object which holds data embedded in
+// the file parent. uri is the location the data would have if it were a
+// standalone file
+func NewEmbeddedFile(parent, uri string, data []byte) *EmbeddedFile {
+	return &EmbeddedFile{
+		FileAttrs: NewFileAttrs(parent, uri, Leaf, nil, nil),
+		data:      data,
+	}
+}
+
+// EmbeddedFileName Returns the name of the standalone file for the embedded
+// data, which is named by the hash of the content
+func EmbeddedFileName(data []byte, mimeType string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]) + utils.ExtensionByMIMEType(mimeType)
+}
+
+// FindDependencies Returns all the dependencies
+func (e *EmbeddedFile) FindDependencies() ([]FileOperator, error) {
+	return make([]FileOperator, 0), nil
+}
+
+// ReplaceDependencyURIs Replaces all the dependencies uri in the file
+func (e *EmbeddedFile) ReplaceDependencyURIs(base, objectKey string, mapper URIMapper) error {
+	return nil
+}
+
+// Open Returns a reader of the data
+func (e *EmbeddedFile) Open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(e.data)), nil
+}
+
+// To Write the data to a new place
+func (e *EmbeddedFile) To(uri string) error {
+	if err := utils.CreateDirectory(filepath.Dir(uri)); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(uri, e.data, 0666)
+}
+
+// ToOBS Write the data to bucket
+func (e *EmbeddedFile) ToOBS(bucket provider.Bucket, key string) error {
+	if bucket == nil {
+		return errors.New("bucket should not be nil")
+	}
+	_, err := bucket.PutObjectFromBytes(filepath.ToSlash(key), e.data)
+	return err
+}
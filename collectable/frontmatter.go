@@ -0,0 +1,261 @@
+package collectable
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/slipfre/imgmd/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFrontMatterKeys Keys of front matter whose values are treated as
+// references to images by default
+var DefaultFrontMatterKeys = []string{"cover", "image", "images"}
+
+var (
+	yamlFrontMatterRegex = regexp.MustCompile(`\A(?:\xEF\xBB\xBF)?---[ \t]*\r?\n`)
+	yamlFrontMatterEnd   = regexp.MustCompile(`(?m)^(?:---|\.\.\.)[ \t]*\r?$`)
+	tomlFrontMatterRegex = regexp.MustCompile(`\A(?:\xEF\xBB\xBF)?\+\+\+[ \t]*\r?\n`)
+	tomlFrontMatterEnd   = regexp.MustCompile(`(?m)^\+\+\+[ \t]*\r?$`)
+	tomlKeyRegex         = regexp.MustCompile(`(?m)^[ \t]*(?:"([^"\n]+)"|'([^'\n]+)'|([A-Za-z0-9_\-]+))[ \t]*=[ \t]*`)
+	tomlTableRegex       = regexp.MustCompile(`(?m)^[ \t]*\[`)
+)
+
+// frontMatterReference A reference found in the value of front matter
+type frontMatterReference struct {
+	reference
+	// quote is the quote around the value, 0 for plain yaml scalars
+	quote byte
+}
+
+// encode Returns the new uri written in the way the value is quoted
+func (r frontMatterReference) encode(newURI []byte) []byte {
+	uri := string(newURI)
+	switch r.quote {
+	case '"':
+		quoted := strconv.Quote(uri)
+		return []byte(quoted[1 : len(quoted)-1])
+	case '\'':
+		if strings.Contains(uri, "'") {
+			return []byte(strings.ReplaceAll(uri, "'", "''"))
+		}
+		return newURI
+	}
+	if strings.Contains(uri, ": ") || strings.Contains(uri, " #") {
+		return []byte(strconv.Quote(uri))
+	}
+	return newURI
+}
+
+// frontMatterReferences Find the references in the front matter of markdown
+// file located at uri. Only the string values, or lists of string values, of
+// the top level keys are references. Values which are not paths of existing
+// files are ignored, since front matter holds other strings as well. Http or
+// https urls are references to remote files if remote is true
+func frontMatterReferences(buffer []byte, uri string, keys []string, remote bool) []frontMatterReference {
+	if len(keys) == 0 {
+		return nil
+	}
+	wanted := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		wanted[key] = struct{}{}
+	}
+
+	var refs []frontMatterReference
+	if start := yamlFrontMatterRegex.FindIndex(buffer); start != nil {
+		if end := yamlFrontMatterEnd.FindIndex(buffer[start[1]:]); end != nil {
+			refs = yamlReferences(buffer[:start[1]+end[0]], start[1], wanted)
+		}
+	} else if start := tomlFrontMatterRegex.FindIndex(buffer); start != nil {
+		if end := tomlFrontMatterEnd.FindIndex(buffer[start[1]:]); end != nil {
+			refs = tomlReferences(buffer[:start[1]+end[0]], start[1], wanted)
+		}
+	}
+
+	found := make([]frontMatterReference, 0, len(refs))
+	for _, ref := range refs {
+		if utils.IsHTTPURI(ref.uri) {
+			if remote {
+				ref.path = ref.uri
+				found = append(found, ref)
+			}
+			continue
+		}
+		refURI := trimQueryAndFragment(ref.uri)
+		path, ok := resolveLocalReference(uri, refURI)
+		if !ok || !utils.IsFileExist(path) {
+			continue
+		}
+		ref.end = ref.start + len(refURI)
+		ref.uri, ref.path = refURI, path
+		found = append(found, ref)
+	}
+	return found
+}
+
+// yamlReferences Find the values of the keys in the yaml front matter, which
+// is buffer[start:]
+func yamlReferences(buffer []byte, start int, keys map[string]struct{}) []frontMatterReference {
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(buffer[start:], &document); err != nil || len(document.Content) == 0 {
+		return nil
+	}
+	mapping := document.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	lineStarts := []int{start}
+	for i := start; i < len(buffer); i++ {
+		if buffer[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offset := func(node *yaml.Node) (int, bool) {
+		if node.Line < 1 || node.Line > len(lineStarts) {
+			return 0, false
+		}
+		pos := lineStarts[node.Line-1]
+		for column := 1; column < node.Column; column++ {
+			if pos >= len(buffer) {
+				return 0, false
+			}
+			_, size := utf8.DecodeRune(buffer[pos:])
+			pos += size
+		}
+		return pos, true
+	}
+
+	refs := make([]frontMatterReference, 0)
+	addScalar := func(node *yaml.Node) {
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+			return
+		}
+		pos, ok := offset(node)
+		if !ok {
+			return
+		}
+		ref := frontMatterReference{}
+		switch node.Style {
+		case 0:
+		case yaml.DoubleQuotedStyle:
+			ref.quote = '"'
+		case yaml.SingleQuotedStyle:
+			ref.quote = '\''
+		default:
+			return
+		}
+		if ref.quote != 0 {
+			pos++
+		}
+		// Values written with escapes or in multiple lines are skipped,
+		// since they can not be replaced in place
+		if !bytes.HasPrefix(buffer[pos:], []byte(node.Value)) {
+			return
+		}
+		ref.start, ref.end, ref.uri = pos, pos+len(node.Value), node.Value
+		refs = append(refs, ref)
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if _, ok := keys[mapping.Content[i].Value]; !ok {
+			continue
+		}
+		value := mapping.Content[i+1]
+		switch value.Kind {
+		case yaml.ScalarNode:
+			addScalar(value)
+		case yaml.SequenceNode:
+			for _, item := range value.Content {
+				addScalar(item)
+			}
+		}
+	}
+	return refs
+}
+
+// tomlReferences Find the values of the keys in the toml front matter, which
+// is buffer[start:]. Keys in tables are not supported
+func tomlReferences(buffer []byte, start int, keys map[string]struct{}) []frontMatterReference {
+	end := len(buffer)
+	if table := tomlTableRegex.FindIndex(buffer[start:]); table != nil {
+		end = start + table[0]
+	}
+	body := buffer[:end]
+
+	refs := make([]frontMatterReference, 0)
+	for _, match := range tomlKeyRegex.FindAllSubmatchIndex(body[start:], -1) {
+		key := ""
+		for i := 2; i < 8; i += 2 {
+			if match[i] >= 0 {
+				key = string(body[start+match[i] : start+match[i+1]])
+			}
+		}
+		if _, ok := keys[key]; !ok {
+			continue
+		}
+		pos := start + match[1]
+		if pos < len(body) && body[pos] == '[' {
+			refs = append(refs, tomlArray(body, pos+1)...)
+		} else if ref, _, ok := tomlString(body, pos); ok {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// tomlArray Returns the strings in the toml array starting at pos
+func tomlArray(buffer []byte, pos int) []frontMatterReference {
+	refs := make([]frontMatterReference, 0)
+	for pos < len(buffer) {
+		switch buffer[pos] {
+		case ']':
+			return refs
+		case '#':
+			for pos < len(buffer) && buffer[pos] != '\n' {
+				pos++
+			}
+		case '"', '\'':
+			ref, next, ok := tomlString(buffer, pos)
+			if ok {
+				refs = append(refs, ref)
+			}
+			pos = next
+			continue
+		}
+		pos++
+	}
+	return refs
+}
+
+// tomlString Returns the single line string starting at pos and the position
+// after it
+func tomlString(buffer []byte, pos int) (frontMatterReference, int, bool) {
+	if pos >= len(buffer) || (buffer[pos] != '"' && buffer[pos] != '\'') {
+		return frontMatterReference{}, pos, false
+	}
+	quote := buffer[pos]
+	end := pos + 1
+	for end < len(buffer) && buffer[end] != quote && buffer[end] != '\n' {
+		if quote == '"' && buffer[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(buffer) || buffer[end] != quote {
+		return frontMatterReference{}, end, false
+	}
+
+	// Strings written with escapes are skipped, since they can not be
+	// replaced in place
+	value := string(buffer[pos+1 : end])
+	if quote == '"' && strings.Contains(value, "\\") {
+		return frontMatterReference{}, end + 1, false
+	}
+	ref := frontMatterReference{quote: quote}
+	ref.start, ref.end, ref.uri = pos+1, end, value
+	return ref, end + 1, true
+}
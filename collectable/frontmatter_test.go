@@ -0,0 +1,99 @@
+package collectable
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownFile_yamlFrontMatter(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "post.md")
+	writeTestFile(t, mdPath, `---
+title: "Hello: world"   # a comment
+cover: ./cover.jpg
+images: [a.png, "b.png"]
+image:
+  - 'c.png'
+tags: [a.png]
+thumbnail: missing.png
+---
+
+![body](a.png)
+`)
+	for _, name := range []string{"cover.jpg", "a.png", "b.png", "c.png"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+
+	collectableFile := NewMarkdownFile("", mdPath)
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	uris := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		uris = append(uris, dependency.GetURI())
+	}
+	require.ElementsMatch(t, []string{
+		filepath.Join(dir, "a.png"),
+		filepath.Join(dir, "cover.jpg"),
+		filepath.Join(dir, "b.png"),
+		filepath.Join(dir, "c.png"),
+	}, uris)
+
+	err = collectableFile.ReplaceDependencies(dir, "post.md", func(dep FileOperator, base, objectKey string) []byte {
+		return []byte("https://cdn.example.com/" + filepath.Base(dep.GetURI()))
+	})
+	require.Nil(t, err)
+	require.Equal(t, `---
+title: "Hello: world"   # a comment
+cover: https://cdn.example.com/cover.jpg
+images: [https://cdn.example.com/a.png, "https://cdn.example.com/b.png"]
+image:
+  - 'https://cdn.example.com/c.png'
+tags: [a.png]
+thumbnail: missing.png
+---
+
+![body](https://cdn.example.com/a.png)
+`, string(collectableFile.buffer))
+}
+
+func TestMarkdownFile_tomlFrontMatter(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "post.md")
+	writeTestFile(t, mdPath, `+++
+title = "Hello"
+cover = "img/cover.jpg"
+images = [
+  "img/a.png", # first
+  'img/b.png',
+]
+
+[params]
+cover = "img/a.png"
++++
+`)
+	for _, name := range []string{"cover.jpg", "a.png", "b.png"} {
+		writeTestFile(t, filepath.Join(dir, "img", name), name)
+	}
+
+	collectableFile := NewMarkdownFile("", mdPath, WithFrontMatterKeys("cover", "images"))
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 3, len(dependencies))
+
+	err = collectableFile.ReplaceDependencyURIs(dir, "post.md", LocalURIMapper)
+	require.Nil(t, err)
+	require.Equal(t, `+++
+title = "Hello"
+cover = "`+filepath.Join("post_medias", "cover.jpg")+`"
+images = [
+  "`+filepath.Join("post_medias", "a.png")+`", # first
+  '`+filepath.Join("post_medias", "b.png")+`',
+]
+
+[params]
+cover = "img/a.png"
++++
+`, string(collectableFile.buffer))
+}
@@ -1,8 +1,12 @@
 package collectable
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -33,3 +37,9 @@ func TestMain(m *testing.M) {
 		os.Exit(code)
 	}
 }
+
+// writeTestFile Write content to the file at path, creating its directory
+func writeTestFile(t *testing.T, path, content string) {
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0777))
+	require.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+}
@@ -0,0 +1,137 @@
+package collectable
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+// Inliner Embeds dependencies into the files which refer to them as base64
+// data uris. Dependencies larger than the max size, or referring to
+// dependencies which can not be inlined, stay as links mapped by the fallback
+// mapper. The size of a dependency referring to others includes the data uris
+// of them, and is checked before they are embedded into it
+type Inliner struct {
+	maxSize  int64
+	fallback DependencyMapper
+	mutex    sync.Mutex
+	// dataURIs are the decided dependencies, "" for the ones not inlined
+	dataURIs map[FileOperator]string
+}
+
+// NewInliner Create an Inliner. Dependencies are inlined regardless of their
+// sizes if maxSize is not positive
+func NewInliner(maxSize int64, fallback DependencyMapper) (*Inliner, error) {
+	if fallback == nil {
+		return nil, errors.New("fallback mapper should not be nil")
+	}
+	return &Inliner{
+		maxSize:  maxSize,
+		fallback: fallback,
+		dataURIs: make(map[FileOperator]string),
+	}, nil
+}
+
+// Map A DependencyMapper which maps the dependency to its data uri, or to the
+// uri mapped by the fallback mapper if it can not be inlined
+func (i *Inliner) Map(dep FileOperator, base, objectKey string) []byte {
+	i.mutex.Lock()
+	pending := make(map[FileOperator]string)
+	dataURI, ok := i.inline(dep, pending)
+	if ok {
+		for inlined, uri := range pending {
+			i.dataURIs[inlined] = uri
+		}
+	} else {
+		i.dataURIs[dep] = ""
+	}
+	i.mutex.Unlock()
+
+	if ok {
+		return []byte(dataURI)
+	}
+	return i.fallback(dep, base, objectKey)
+}
+
+// IsInlined Returns true if the dependency has been embedded into the file
+// referring to it, which means it needs not to be collected
+func (i *Inliner) IsInlined(dep FileOperator) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.dataURIs[dep] != ""
+}
+
+// inline Returns the data uri of dep. Dependencies of dep are inlined into it
+// first. The decisions are recorded in pending, so that they can be discarded
+// if dep itself can not be inlined
+func (i *Inliner) inline(dep FileOperator, pending map[FileOperator]string) (string, bool) {
+	if dataURI, ok := i.dataURIs[dep]; ok {
+		return dataURI, dataURI != ""
+	}
+	if dataURI, ok := pending[dep]; ok {
+		return dataURI, dataURI != ""
+	}
+	// Mark dep as not inlined until it is done, which breaks reference cycles
+	pending[dep] = ""
+
+	deps, err := dep.FindDependencies()
+	if err != nil {
+		return "", false
+	}
+	for _, d := range deps {
+		if _, ok := i.inline(d, pending); !ok {
+			return "", false
+		}
+	}
+
+	// Replacing the dependencies can not be undone, so the size is checked
+	// before dep is changed
+	limit := i.maxSize
+	for _, d := range deps {
+		limit -= int64(len(pending[d]))
+	}
+	if i.maxSize > 0 && limit <= 0 {
+		return "", false
+	}
+	data, ok := i.read(dep, limit)
+	if !ok {
+		return "", false
+	}
+	if len(deps) > 0 {
+		err = ReplaceDependencies(dep, "", "", func(d FileOperator, base, objectKey string) []byte {
+			return []byte(pending[d])
+		})
+		if err != nil {
+			return "", false
+		}
+		if data, ok = i.read(dep, 0); !ok {
+			return "", false
+		}
+	}
+	dataURI := utils.EncodeDataURI(data, utils.DetectMIMEType(FileName(dep), data))
+	pending[dep] = dataURI
+	return dataURI, true
+}
+
+// read Returns the content of dep, false if it is larger than limit. The size
+// is not limited if limit is not positive
+func (i *Inliner) read(dep FileOperator, limit int64) ([]byte, bool) {
+	reader, err := Open(dep)
+	if err != nil {
+		return nil, false
+	}
+	defer reader.Close()
+
+	var r io.Reader = reader
+	if limit > 0 {
+		r = io.LimitReader(reader, limit+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || (limit > 0 && int64(len(data)) > limit) {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,125 @@
+package collectable
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInliner(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "doc.md")
+	writeTestFile(t, mdPath, `<link rel="stylesheet" href="style.css">
+
+![small](small.png)
+![big](big.png)
+`)
+	writeTestFile(t, filepath.Join(dir, "small.png"), "tiny")
+	writeTestFile(t, filepath.Join(dir, "big.png"), strings.Repeat("x", 256))
+	writeTestFile(t, filepath.Join(dir, "style.css"), `p{background:url(dot.gif)}`)
+	writeTestFile(t, filepath.Join(dir, "dot.gif"), "GIF89a")
+
+	inliner, err := NewInliner(128, NewLocalDependencyMapper(DependencyKey))
+	require.Nil(t, err)
+
+	collectableFile := NewMarkdownFile("", mdPath)
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 3, len(dependencies))
+
+	err = collectableFile.ReplaceDependencies(dir, "doc.md", inliner.Map)
+	require.Nil(t, err)
+
+	for _, dependency := range dependencies {
+		inlined := filepath.Base(dependency.GetURI()) != "big.png"
+		require.Equal(t, inlined, inliner.IsInlined(dependency), dependency.GetURI())
+	}
+
+	gif := "data:image/gif;base64," + base64.StdEncoding.EncodeToString([]byte("GIF89a"))
+	css := "data:text/css;base64," + base64.StdEncoding.EncodeToString([]byte("p{background:url("+gif+")}"))
+	png := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("tiny"))
+	require.Equal(t, `<link rel="stylesheet" href="`+css+`">
+
+![small](`+png+`)
+![big](`+filepath.Join("doc_medias", "big.png")+`)
+`, string(collectableFile.buffer))
+}
+
+func TestInliner_nestedTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "doc.md")
+	writeTestFile(t, mdPath, `<link rel="stylesheet" href="style.css">`)
+	writeTestFile(t, filepath.Join(dir, "style.css"), `p{background:url(big.png)}`)
+	writeTestFile(t, filepath.Join(dir, "big.png"), strings.Repeat("x", 256))
+
+	inliner, err := NewInliner(128, NewLocalDependencyMapper(DependencyKey))
+	require.Nil(t, err)
+
+	collectableFile := NewMarkdownFile("", mdPath)
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(dependencies))
+
+	err = collectableFile.ReplaceDependencies(dir, "doc.md", inliner.Map)
+	require.Nil(t, err)
+	require.False(t, inliner.IsInlined(dependencies[0]))
+	require.Equal(t, `<link rel="stylesheet" href="`+filepath.Join("doc_medias", "style.css")+`">`, string(collectableFile.buffer))
+
+	// The stylesheet is collected as usual, so are its dependencies
+	nested, err := dependencies[0].FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(nested))
+	require.False(t, inliner.IsInlined(nested[0]))
+}
+
+func TestInliner_tooLargeAfterEmbedding(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "doc.md")
+	writeTestFile(t, mdPath, `<link rel="stylesheet" href="style.css">`)
+	writeTestFile(t, filepath.Join(dir, "style.css"), `p{background:url(dot.gif)}`)
+	writeTestFile(t, filepath.Join(dir, "dot.gif"), strings.Repeat("x", 80))
+
+	inliner, err := NewInliner(128, NewLocalDependencyMapper(DependencyKey))
+	require.Nil(t, err)
+
+	collectableFile := NewMarkdownFile("", mdPath)
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(dependencies))
+
+	// The stylesheet fits in the max size, but not with the data uri of the
+	// image embedded
+	err = collectableFile.ReplaceDependencies(dir, "doc.md", inliner.Map)
+	require.Nil(t, err)
+	require.False(t, inliner.IsInlined(dependencies[0]))
+
+	// The stylesheet is left unchanged for the fallback mapper
+	stylesheet := dependencies[0].(*CSSFile)
+	require.Equal(t, `p{background:url(dot.gif)}`, string(stylesheet.buffer))
+	nested, err := stylesheet.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(nested))
+	require.False(t, inliner.IsInlined(nested[0]))
+}
+
+func TestInliner_remote(t *testing.T) {
+	server := newTestImageServer(t)
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "doc.md")
+	writeTestFile(t, mdPath, "![avatar]("+server.URL+"/avatar)\n")
+
+	inliner, err := NewInliner(128, NewLocalDependencyMapper(DependencyKey))
+	require.Nil(t, err)
+
+	// Remote images are downloaded to be embedded
+	collectableFile := NewMarkdownFile("", mdPath, WithRemotePolicy(RemoteMirror))
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Len(t, dependencies, 1)
+	require.Nil(t, collectableFile.ReplaceDependencies(dir, "doc.md", inliner.Map))
+	require.True(t, inliner.IsInlined(dependencies[0]))
+	require.Equal(t, "![avatar](data:image/png;base64,"+base64.StdEncoding.EncodeToString(testPNG)+")\n", string(collectableFile.buffer))
+}
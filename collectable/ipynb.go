@@ -0,0 +1,359 @@
+package collectable
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/slipfre/imgmd/provider"
+	"github.com/slipfre/imgmd/utils"
+)
+
+const attachmentScheme = "attachment:"
+
+// embeddableMIMETypes Types of images which are stored as base64 in notebooks
+var embeddableMIMETypes = []string{"image/gif", "image/jpeg", "image/png", "image/webp"}
+
+func init() {
+	RegisterDocument(IPYNB, func(parent, uri string, options ...Option) FileOperator {
+		return NewIPYNBFile(parent, uri, options...)
+	}, ".ipynb")
+}
+
+// IPYNBFile Collectable files which is jupyter notebook. Images referred by
+// markdown cells are its dependencies. If WithExtractEmbedded is set, images
+// stored in cell attachments and outputs are extracted as dependencies as well
+type IPYNBFile struct {
+	*FileAttrs
+	buffer       []byte
+	configs      *Configs
+	dependencies dependencyCache
+}
+
+// notebookDependency A dependency found in the notebook
+type notebookDependency struct {
+	// uri is the uri written in the notebook, or the name of the extracted
+	// file for embedded images
+	uri  string
+	path string
+	// data is the content of the embedded image, nil for local file
+	data []byte
+}
+
+// NewIPYNBFile Create a IPYNBFile object which is a collectable file for
+// jupyter notebook
+func NewIPYNBFile(parent, uri string, options ...Option) *IPYNBFile {
+	uri, data, updatedTime, fError := readFile(uri)
+	return &IPYNBFile{
+		FileAttrs:    NewFileAttrs(parent, uri, IPYNB, updatedTime, fError),
+		buffer:       data,
+		configs:      newConfigs(options...),
+		dependencies: make(dependencyCache),
+	}
+}
+
+// FindDependencies Returns images referred or embedded in the notebook
+func (n *IPYNBFile) FindDependencies() ([]FileOperator, error) {
+	if err := n.FileError(); err != nil {
+		return nil, err
+	}
+
+	notebook, err := n.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	dependencies := make([]FileOperator, 0)
+	found := make(map[string]struct{})
+	n.rewrite(notebook, func(dep notebookDependency) (string, bool) {
+		if _, ok := found[dep.path]; !ok {
+			found[dep.path] = struct{}{}
+			dependencies = append(dependencies, n.dependency(dep))
+		}
+		return "", false
+	})
+	return dependencies, nil
+}
+
+// ReplaceDependencyURIs Replace the uris of the dependencies by the uris
+// mapped by mapper
+func (n *IPYNBFile) ReplaceDependencyURIs(base, objectKey string, mapper URIMapper) error {
+	return n.ReplaceDependencies(base, objectKey, mapper.DependencyMapper())
+}
+
+// ReplaceDependencies Replace the uris of images in the notebook, embedded
+// images are replaced by references to the extracted files
+func (n *IPYNBFile) ReplaceDependencies(base, objectKey string, mapper DependencyMapper) error {
+	if err := n.FileError(); err != nil {
+		return err
+	}
+
+	notebook, err := n.decode()
+	if err != nil {
+		return err
+	}
+
+	changed := n.rewrite(notebook, func(dep notebookDependency) (string, bool) {
+		return string(mapper(n.dependency(dep), base, objectKey)), true
+	})
+	if !changed {
+		return nil
+	}
+
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", " ")
+	if err := encoder.Encode(notebook); err != nil {
+		return err
+	}
+	n.buffer = buffer.Bytes()
+	return nil
+}
+
+// Open Returns a reader of the buffer
+func (n *IPYNBFile) Open() (io.ReadCloser, error) {
+	if err := n.FileError(); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(n.buffer)), nil
+}
+
+// To Write the buffer to file
+func (n *IPYNBFile) To(uri string) error {
+	if err := n.FileError(); err != nil {
+		return err
+	}
+	if err := utils.CreateDirectory(filepath.Dir(uri)); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(uri, n.buffer, 0666)
+}
+
+// ToOBS Write the file to bucket
+func (n *IPYNBFile) ToOBS(bucket provider.Bucket, key string) error {
+	if err := n.FileError(); err != nil {
+		return err
+	}
+	if bucket == nil {
+		return errors.New("bucket should not be nil")
+	}
+	_, err := bucket.PutObjectFromBytes(filepath.ToSlash(key), n.buffer)
+	return err
+}
+
+func (n *IPYNBFile) decode() (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(n.buffer))
+	decoder.UseNumber()
+	notebook := make(map[string]interface{})
+	if err := decoder.Decode(&notebook); err != nil {
+		return nil, err
+	}
+	return notebook, nil
+}
+
+// rewrite Visit all the dependencies in the notebook. replace returns the new
+// uri of the dependency and whether the notebook should be changed. Returns
+// true if the notebook is changed
+func (n *IPYNBFile) rewrite(notebook map[string]interface{}, replace func(dep notebookDependency) (string, bool)) bool {
+	changed := false
+	cells, _ := notebook["cells"].([]interface{})
+	for _, c := range cells {
+		cell, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch cell["cell_type"] {
+		case "markdown":
+			if n.rewriteMarkdownCell(cell, replace) {
+				changed = true
+			}
+		case "code":
+			if n.rewriteOutputs(cell, replace) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func (n *IPYNBFile) rewriteMarkdownCell(cell map[string]interface{}, replace func(dep notebookDependency) (string, bool)) bool {
+	source := []byte(joinSource(cell["source"]))
+	attachments, _ := cell["attachments"].(map[string]interface{})
+
+	refs := make([]reference, 0)
+	deps := make(map[int]notebookDependency)
+	extracted := make(map[string]struct{})
+	for _, match := range GetMarkdownImgRegex().FindAllSubmatchIndex(source, -1) {
+		start, end := match[4], match[5]
+		uri := string(source[start:end])
+
+		var dep notebookDependency
+		if strings.HasPrefix(uri, attachmentScheme) {
+			name := strings.TrimPrefix(uri, attachmentScheme)
+			data, mimeType, ok := decodeMIMEBundle(attachments[name])
+			if !n.configs.ExtractEmbedded || !ok {
+				continue
+			}
+			extracted[name] = struct{}{}
+			dep = n.embeddedDependency(data, mimeType)
+		} else if utils.IsHTTPURI(uri) {
+			if !n.configs.mirrorRemote() {
+				continue
+			}
+			dep = notebookDependency{uri: uri, path: uri}
+		} else {
+			uri = trimQueryAndFragment(uri)
+			path, ok := resolveLocalReference(n.uri, uri)
+			if !ok {
+				continue
+			}
+			end = start + len(uri)
+			dep = notebookDependency{uri: uri, path: path}
+		}
+		deps[start] = dep
+		refs = append(refs, reference{start: start, end: end, uri: dep.uri, path: dep.path})
+	}
+
+	changed := false
+	newSource := replaceReferences(source, refs, func(ref reference) []byte {
+		newURI, ok := replace(deps[ref.start])
+		if !ok {
+			return source[ref.start:ref.end]
+		}
+		changed = true
+		return []byte(newURI)
+	})
+	if !changed {
+		return false
+	}
+
+	cell["source"] = splitSource(string(newSource))
+	for name := range extracted {
+		delete(attachments, name)
+	}
+	if attachments != nil && len(attachments) == 0 {
+		delete(cell, "attachments")
+	}
+	return true
+}
+
+func (n *IPYNBFile) rewriteOutputs(cell map[string]interface{}, replace func(dep notebookDependency) (string, bool)) bool {
+	if !n.configs.ExtractEmbedded {
+		return false
+	}
+
+	changed := false
+	outputs, _ := cell["outputs"].([]interface{})
+	for _, o := range outputs {
+		output, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		bundle, ok := output["data"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := bundle["text/markdown"]; ok {
+			continue
+		}
+		data, mimeType, ok := decodeMIMEBundle(bundle)
+		if !ok {
+			continue
+		}
+		newURI, ok := replace(n.embeddedDependency(data, mimeType))
+		if !ok {
+			continue
+		}
+		// Only the extracted image is replaced, the other representations
+		// in the bundle are kept
+		delete(bundle, mimeType)
+		if metadata, ok := output["metadata"].(map[string]interface{}); ok {
+			delete(metadata, mimeType)
+		}
+		bundle["text/markdown"] = "![output](" + newURI + ")"
+		changed = true
+	}
+	return changed
+}
+
+// dependency Returns the collectable file of the dependency
+func (n *IPYNBFile) dependency(dep notebookDependency) FileOperator {
+	return n.dependencies.get(dep.path, func() FileOperator {
+		if dep.data != nil {
+			return NewEmbeddedFile(n.uri, dep.path, dep.data)
+		}
+		return NewFile(n.uri, dep.path, n.configs.dependencyOptions(n.uri)...)
+	})
+}
+
+func (n *IPYNBFile) embeddedDependency(data []byte, mimeType string) notebookDependency {
+	name := EmbeddedFileName(data, mimeType)
+	return notebookDependency{
+		uri:  name,
+		path: filepath.Join(filepath.Dir(n.uri), name),
+		data: data,
+	}
+}
+
+// decodeMIMEBundle Returns the first image in the mime bundle which is
+// encoded as base64
+func decodeMIMEBundle(b interface{}) ([]byte, string, bool) {
+	bundle, ok := b.(map[string]interface{})
+	if !ok {
+		return nil, "", false
+	}
+	mimeTypes := make([]string, 0, len(bundle))
+	for mimeType := range bundle {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	sort.Strings(mimeTypes)
+	for _, mimeType := range mimeTypes {
+		if i := sort.SearchStrings(embeddableMIMETypes, mimeType); i == len(embeddableMIMETypes) || embeddableMIMETypes[i] != mimeType {
+			continue
+		}
+		encoded := strings.Join(strings.Fields(joinSource(bundle[mimeType])), "")
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		return data, mimeType, true
+	}
+	return nil, "", false
+}
+
+// joinSource Join the multiline string of notebook, which is either a string
+// or a list of strings
+func joinSource(source interface{}) string {
+	switch s := source.(type) {
+	case string:
+		return s
+	case []interface{}:
+		builder := strings.Builder{}
+		for _, line := range s {
+			if l, ok := line.(string); ok {
+				builder.WriteString(l)
+			}
+		}
+		return builder.String()
+	}
+	return ""
+}
+
+// splitSource Split the string to lines in the way notebooks store multiline
+// strings
+func splitSource(source string) []interface{} {
+	lines := make([]interface{}, 0)
+	for _, line := range strings.SplitAfter(source, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,113 @@
+package collectable
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPYNBFile(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\nfake")
+	encoded := base64.StdEncoding.EncodeToString(png)
+	nbPath := filepath.Join(dir, "analysis.ipynb")
+	writeTestFile(t, filepath.Join(dir, "img", "chart.png"), "chart")
+	writeTestFile(t, nbPath, `{
+ "cells": [
+  {
+   "attachments": {
+    "pasted.png": {
+     "image/png": "`+encoded+`"
+    }
+   },
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# Report\n",
+    "![Chart](img/chart.png)\n",
+    "![Pasted](attachment:pasted.png)"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 1,
+   "metadata": {},
+   "outputs": [
+    {
+     "data": {
+      "image/png": "`+encoded+`\n",
+      "image/svg+xml": [
+       "<svg/>"
+      ],
+      "image/webp": "`+encoded+`",
+      "text/plain": [
+       "<Figure size 640x480 with 1 Axes>"
+      ]
+     },
+     "metadata": {
+      "image/png": {
+       "width": 640
+      }
+     },
+     "output_type": "display_data"
+    }
+   ],
+   "source": [
+    "plot()"
+   ]
+  }
+ ],
+ "metadata": {},
+ "nbformat": 4,
+ "nbformat_minor": 4
+}
+`)
+	embeddedName := EmbeddedFileName(png, "image/png")
+
+	var collectableFile FileOperator = NewIPYNBFile("", nbPath)
+	require.Nil(t, collectableFile.FileError())
+	require.Equal(t, IPYNB, collectableFile.GetFileType())
+
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(dependencies))
+	require.Equal(t, filepath.Join(dir, "img", "chart.png"), dependencies[0].GetURI())
+
+	collectableFile = NewIPYNBFile("", nbPath, WithExtractEmbedded(true))
+	dependencies, err = collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(dependencies))
+	require.Equal(t, filepath.Join(dir, embeddedName), dependencies[1].GetURI())
+
+	targetPath := filepath.Join(dir, "out", embeddedName)
+	require.Nil(t, dependencies[1].To(targetPath))
+	require.FileExists(t, targetPath)
+
+	err = collectableFile.ReplaceDependencyURIs(dir, "analysis.ipynb", LocalURIMapper)
+	require.Nil(t, err)
+
+	notebook := make(map[string]interface{})
+	require.Nil(t, json.Unmarshal(collectableFile.(*IPYNBFile).buffer, &notebook))
+	cells := notebook["cells"].([]interface{})
+
+	markdownCell := cells[0].(map[string]interface{})
+	require.NotContains(t, markdownCell, "attachments")
+	require.Equal(t, []interface{}{
+		"# Report\n",
+		"![Chart](analysis_medias/chart.png)\n",
+		"![Pasted](analysis_medias/" + embeddedName + ")",
+	}, markdownCell["source"])
+
+	output := cells[1].(map[string]interface{})["outputs"].([]interface{})[0].(map[string]interface{})
+	// The alternative representations are kept
+	require.Equal(t, map[string]interface{}{
+		"text/markdown": "![output](analysis_medias/" + embeddedName + ")",
+		"image/svg+xml": []interface{}{"<svg/>"},
+		"image/webp":    encoded,
+		"text/plain":    []interface{}{"<Figure size 640x480 with 1 Axes>"},
+	}, output["data"])
+	require.Equal(t, map[string]interface{}{}, output["metadata"])
+}
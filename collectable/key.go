@@ -0,0 +1,276 @@
+package collectable
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+// KeyFunc Returns the object key of the dependency collected along with the
+// file collected to base/objectKey
+type KeyFunc func(dep FileOperator, base, objectKey string) string
+
+// DependencyKey The default KeyFunc, which collects the dependency to
+// 'objectKey_medias/filename'. Dependencies with the same file name get the
+// same key, wrap it by a KeyAssigner to collect them to distinct keys
+func DependencyKey(dep FileOperator, base, objectKey string) string {
+	return filepath.Join(utils.GetTargetResourcesDirPath(objectKey), FileName(dep))
+}
+
+// NewLayoutKey Returns a KeyFunc which keeps the layout of the dependencies,
+// collecting them to 'objectKey_medias/path' where path is relative to root, or
+// to the file referring to them if root is empty. Dependencies out of root,
+// and the ones not on the local disk, are collected to
+// 'objectKey_medias/filename'
+func NewLayoutKey(root string) KeyFunc {
+	if root != "" {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+	}
+	return func(dep FileOperator, base, objectKey string) string {
+		dir := root
+		if dir == "" {
+			dir = filepath.Dir(dep.GetParent())
+		}
+		if path, ok := relativePath(dir, dep.GetURI()); ok {
+			return filepath.Join(utils.GetTargetResourcesDirPath(objectKey), path)
+		}
+		return DependencyKey(dep, base, objectKey)
+	}
+}
+
+// relativePath Returns the path of uri relative to dir, false if uri is not a
+// local path under dir
+func relativePath(dir, uri string) (string, bool) {
+	if uri == "" || utils.IsHTTPURI(uri) {
+		return "", false
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	uri, err = filepath.Abs(uri)
+	if err != nil {
+		return "", false
+	}
+	path, err := filepath.Rel(dir, uri)
+	if err != nil || path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path, true
+}
+
+// KeyAssigner Assigns distinct keys to distinct source files. The first file
+// gets the key returned by its KeyFunc, and the other files getting the same
+// key are collected to 'name-hash.ext' instead, where hash is derived from
+// their paths relative to the files referring to them, so that they do not
+// overwrite each other. The collectors ask for the keys of the dependencies of
+// a file sorted by source, so that which of them comes first does not depend
+// on the timing. Keys differing only in case are regarded as the same, as they
+// are on some file systems. Keys under different bases are assigned separately.
+// A KeyAssigner remembers the keys it assigned, so a new one should be created
+// for each run
+type KeyAssigner struct {
+	key   KeyFunc
+	mutex sync.Mutex
+	// sources are the uris of the files collected to the targets
+	sources map[string]string
+}
+
+// NewKeyAssigner Create a KeyAssigner which assigns the keys returned by key
+func NewKeyAssigner(key KeyFunc) *KeyAssigner {
+	return &KeyAssigner{
+		key:     key,
+		sources: make(map[string]string),
+	}
+}
+
+// Key A KeyFunc which returns the key assigned to the dependency
+func (a *KeyAssigner) Key(dep FileOperator, base, objectKey string) string {
+	key := a.key(dep, base, objectKey)
+	source := sourceKey(dep)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for i := 0; ; i++ {
+		candidate := key
+		if i > 0 {
+			candidate = withHashSuffix(key, referencePath(dep), i)
+		}
+		target := strings.ToLower(filepath.Join(base, candidate))
+		assigned, ok := a.sources[target]
+		if !ok {
+			a.sources[target] = source
+			return candidate
+		}
+		if assigned == source {
+			return candidate
+		}
+	}
+}
+
+// referencePath Returns the path of the dependency relative to the file
+// referring to it, or its uri if it is remote or not referred by a local file,
+// so that the path does not depend on where the files are
+func referencePath(dep FileOperator) string {
+	source := sourceKey(dep)
+	if parent := dep.GetParent(); parent != "" && !utils.IsHTTPURI(parent) {
+		if path, err := filepath.Rel(filepath.Dir(parent), source); err == nil && !utils.IsHTTPURI(source) {
+			return filepath.ToSlash(path)
+		}
+	}
+	return source
+}
+
+// withHashSuffix Returns 'name-hash.ext' of key, with the n-th hash of path
+func withHashSuffix(key, path string, n int) string {
+	if n > 1 {
+		path = fmt.Sprintf("%s#%d", path, n)
+	}
+	sum := sha256.Sum256([]byte(path))
+	ext := filepath.Ext(key)
+	return strings.TrimSuffix(key, ext) + "-" + hex.EncodeToString(sum[:4]) + ext
+}
+
+// ContentAddresser Collects dependencies by their content. Dependencies with the
+// same content share the key 'dir/hash.ext' wherever they are referred, so that
+// they are stored only once
+type ContentAddresser struct {
+	dir    string
+	hasher *contentHasher
+}
+
+// NewContentAddresser Create a ContentAddresser which collects dependencies
+// into dir
+func NewContentAddresser(dir string) *ContentAddresser {
+	return &ContentAddresser{
+		dir:    dir,
+		hasher: newContentHasher(),
+	}
+}
+
+// Key A KeyFunc which returns the content addressed key of the dependency. The
+// dependency is collected by DependencyKey if it can not be content addressed
+func (a *ContentAddresser) Key(dep FileOperator, base, objectKey string) string {
+	hash, ok := a.hasher.Hash(dep)
+	if !ok {
+		return DependencyKey(dep, base, objectKey)
+	}
+	return filepath.Join(a.dir, hash[:32]+filepath.Ext(FileName(dep)))
+}
+
+// contentHasher Hashes the contents of dependencies, once for each source. The
+// contents are read out of the mutex, and a source being hashed is waited for
+// instead of being read again
+type contentHasher struct {
+	mutex sync.Mutex
+	// hashes are the hashes of the sources, keyed by sourceKey
+	hashes map[string]*hashCall
+}
+
+// hashCall The hash of a source, done is closed once it is hashed
+type hashCall struct {
+	done chan struct{}
+	hash string
+	ok   bool
+}
+
+func newContentHasher() *contentHasher {
+	return &contentHasher{hashes: make(map[string]*hashCall)}
+}
+
+// sourceKey Returns the cleaned uri of the file, by which its hash is cached
+func sourceKey(file FileOperator) string {
+	uri := file.GetURI()
+	if utils.IsHTTPURI(uri) {
+		return uri
+	}
+	return filepath.Clean(uri)
+}
+
+// Hash Returns the hex encoded sha256 hash of dep, false if it can not be read
+func (h *contentHasher) Hash(dep FileOperator) (string, bool) {
+	key := sourceKey(dep)
+	h.mutex.Lock()
+	if call, ok := h.hashes[key]; ok {
+		h.mutex.Unlock()
+		<-call.done
+		return call.hash, call.ok
+	}
+	call := &hashCall{done: make(chan struct{})}
+	h.hashes[key] = call
+	h.mutex.Unlock()
+
+	call.hash, call.ok = h.hash(dep, map[string]struct{}{key: {}})
+	if !call.ok {
+		// Failures are not cached, the source may be read later
+		h.mutex.Lock()
+		delete(h.hashes, key)
+		h.mutex.Unlock()
+	}
+	close(call.done)
+	return call.hash, call.ok
+}
+
+// hash Returns the hash of dep. Files referring to dependencies are collected
+// with the references replaced, so the hashes of the dependencies are hashed
+// along with the content. The dependencies hashed already are taken from the
+// cache, and the others are hashed here rather than waited for, since waiting
+// for a dependency referring back to a file being hashed never ends. visiting
+// are the sources being hashed by this call, a dependency referring back to
+// them can not be hashed
+func (h *contentHasher) hash(dep FileOperator, visiting map[string]struct{}) (string, bool) {
+	deps, err := dep.FindDependencies()
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.New()
+	for _, d := range deps {
+		hash, ok := h.dependencyHash(d, visiting)
+		if !ok {
+			return "", false
+		}
+		io.WriteString(sum, hash+filepath.Ext(FileName(d))+"\n")
+	}
+
+	reader, err := Open(dep)
+	if err != nil {
+		return "", false
+	}
+	defer reader.Close()
+	if _, err = io.Copy(sum, reader); err != nil {
+		return "", false
+	}
+	return hex.EncodeToString(sum.Sum(nil)), true
+}
+
+// dependencyHash Returns the hash of the dependency of a file being hashed
+func (h *contentHasher) dependencyHash(dep FileOperator, visiting map[string]struct{}) (string, bool) {
+	key := sourceKey(dep)
+	if _, ok := visiting[key]; ok {
+		return "", false
+	}
+	h.mutex.Lock()
+	call, ok := h.hashes[key]
+	h.mutex.Unlock()
+	if ok {
+		select {
+		case <-call.done:
+			if call.ok {
+				return call.hash, true
+			}
+		default:
+		}
+	}
+
+	visiting[key] = struct{}{}
+	defer delete(visiting, key)
+	return h.hash(dep, visiting)
+}
@@ -0,0 +1,149 @@
+package collectable
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentAddresser(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a", "doc.md"), "![logo](logo.png)\n<link rel=\"stylesheet\" href=\"style.css\">\n")
+	writeTestFile(t, filepath.Join(dir, "a", "logo.png"), "logo")
+	writeTestFile(t, filepath.Join(dir, "a", "style.css"), "p { background: url(bg.png); }")
+	writeTestFile(t, filepath.Join(dir, "a", "bg.png"), "bg")
+	writeTestFile(t, filepath.Join(dir, "b", "doc.md"), "![logo](copy.png)\n<link rel=\"stylesheet\" href=\"style.css\">\n")
+	writeTestFile(t, filepath.Join(dir, "b", "copy.png"), "logo")
+	writeTestFile(t, filepath.Join(dir, "b", "style.css"), "p { background: url(bg.png); }")
+	writeTestFile(t, filepath.Join(dir, "b", "bg.png"), "another bg")
+
+	addresser := NewContentAddresser("_medias")
+	keys := make([][]string, 2)
+	for i, name := range []string{"a", "b"} {
+		deps, err := NewMarkdownFile("", filepath.Join(dir, name, "doc.md")).FindDependencies()
+		require.Nil(t, err)
+		require.Len(t, deps, 2)
+		for _, dep := range deps {
+			key := addresser.Key(dep, dir, filepath.Join(name, "doc.md"))
+			require.Equal(t, "_medias", filepath.Dir(key))
+			require.Equal(t, filepath.Ext(dep.GetURI()), filepath.Ext(key))
+			require.Equal(t, key, addresser.Key(dep, dir, filepath.Join(name, "doc.md")))
+			keys[i] = append(keys[i], key)
+		}
+	}
+
+	// Identical images share the key, while the same stylesheet referring to
+	// different images does not
+	require.Equal(t, keys[0][0], keys[1][0])
+	require.NotEqual(t, keys[0][1], keys[1][1])
+}
+
+func TestContentAddresser_mapper(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "docs", "doc.md")
+	writeTestFile(t, mdPath, "![logo](logo.png)\n")
+	writeTestFile(t, filepath.Join(dir, "docs", "logo.png"), "logo")
+
+	md := NewMarkdownFile("", mdPath)
+	deps, err := md.FindDependencies()
+	require.Nil(t, err)
+	key := NewContentAddresser("_medias").Key
+	require.Nil(t, md.ReplaceDependencies(dir, filepath.Join("docs", "doc.md"), NewLocalDependencyMapper(key)))
+	require.Equal(t, "![logo](../"+filepath.ToSlash(key(deps[0], dir, ""))+")\n", string(md.buffer))
+
+	// The default key collects the dependency beside the file
+	require.Equal(t, filepath.Join("docs", "doc_medias", "logo.png"), DependencyKey(deps[0], dir, filepath.Join("docs", "doc.md")))
+}
+
+func TestContentHasher_concurrent(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "style.css"), "p { background: url(bg.png); }")
+	writeTestFile(t, filepath.Join(dir, "bg.png"), "bg")
+
+	// The same source opened by different files is hashed once, and files
+	// hashed at the same time do not wait for each other
+	hasher := newContentHasher()
+	hashes := make([]string, 8)
+	wg := sync.WaitGroup{}
+	for i := range hashes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			uri := filepath.Join(dir, "style.css")
+			if i%2 == 1 {
+				uri = filepath.Join(dir, ".", "style.css")
+			}
+			hash, ok := hasher.Hash(NewFile("", uri))
+			require.True(t, ok)
+			hashes[i] = hash
+		}(i)
+	}
+	wg.Wait()
+	for _, hash := range hashes {
+		require.Equal(t, hashes[0], hash)
+	}
+	require.Len(t, hasher.hashes, 1)
+
+	_, ok := hasher.Hash(NewFile("", filepath.Join(dir, "missing.png")))
+	require.False(t, ok)
+	require.Len(t, hasher.hashes, 1)
+}
+
+func TestKeyAssigner(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "doc.md")
+	writeTestFile(t, mdPath, "![a](a/shot.png) ![b](b/shot.png) ![c](c/Shot.png) ![a](a/shot.png)\n")
+	for _, name := range []string{"a/shot.png", "b/shot.png", "c/Shot.png"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+
+	md := NewMarkdownFile("", mdPath)
+	deps, err := md.FindDependencies()
+	require.Nil(t, err)
+	require.Len(t, deps, 3)
+
+	assigner := NewKeyAssigner(DependencyKey)
+	keys := make(map[string]struct{})
+	for _, dep := range deps {
+		keys[assigner.Key(dep, dir, "doc.md")] = struct{}{}
+	}
+	require.Len(t, keys, 3)
+	require.Contains(t, keys, filepath.Join("doc_medias", "shot.png"))
+
+	// The keys are stable, and shared by the mapper
+	require.Nil(t, md.ReplaceDependencies(dir, "doc.md", NewLocalDependencyMapper(assigner.Key)))
+	require.Equal(t, "![a](doc_medias/shot.png) ![b]("+filepath.ToSlash(assigner.Key(deps[1], dir, "doc.md"))+
+		") ![c]("+filepath.ToSlash(assigner.Key(deps[2], dir, "doc.md"))+") ![a](doc_medias/shot.png)\n", string(md.buffer))
+	require.Equal(t, withHashSuffix(filepath.Join("doc_medias", "shot.png"), "b/shot.png", 1), assigner.Key(deps[1], dir, "doc.md"))
+
+	// Keys under different bases are assigned separately
+	require.Equal(t, filepath.Join("doc_medias", "shot.png"), assigner.Key(deps[1], filepath.Join(dir, "other"), "doc.md"))
+}
+
+func TestNewLayoutKey(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "docs", "doc.md")
+	writeTestFile(t, mdPath, "![1](img/chapter1/a.png) ![2](img/chapter2/a.png) ![3](../shared/b.png)\n")
+	for _, name := range []string{"docs/img/chapter1/a.png", "docs/img/chapter2/a.png", "shared/b.png"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+
+	md := NewMarkdownFile("", mdPath)
+	deps, err := md.FindDependencies()
+	require.Nil(t, err)
+	require.Len(t, deps, 3)
+
+	key := NewLayoutKey("")
+	require.Equal(t, filepath.Join("doc_medias", "img", "chapter1", "a.png"), key(deps[0], dir, "doc.md"))
+	require.Equal(t, filepath.Join("doc_medias", "img", "chapter2", "a.png"), key(deps[1], dir, "doc.md"))
+	require.Equal(t, filepath.Join("doc_medias", "b.png"), key(deps[2], dir, "doc.md"))
+
+	key = NewLayoutKey(dir)
+	require.Equal(t, filepath.Join("doc_medias", "docs", "img", "chapter1", "a.png"), key(deps[0], dir, "doc.md"))
+	require.Equal(t, filepath.Join("doc_medias", "shared", "b.png"), key(deps[2], dir, "doc.md"))
+
+	require.Nil(t, md.ReplaceDependencies(dir, filepath.Join("out", "doc.md"), NewLocalDependencyMapper(NewLayoutKey(""))))
+	require.Equal(t, "![1](doc_medias/img/chapter1/a.png) ![2](doc_medias/img/chapter2/a.png) ![3](doc_medias/b.png)\n", string(md.buffer))
+}
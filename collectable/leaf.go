@@ -2,9 +2,10 @@ package collectable
 
 import (
 	"errors"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/slipfre/imgmd/provider"
@@ -14,18 +15,22 @@ import (
 // LeafFile Collectable file which has no dependencies
 type LeafFile struct {
 	*FileAttrs
+	configs *Configs
 }
 
-// NewLeafFile 创建一个 LeafCollector，它可以 collect 没有依赖项的文件
-func NewLeafFile(parent, uri string) *LeafFile {
-	reader, fError := utils.NewFileReader(uri)
-	defer reader.Close()
-
+// NewLeafFile 创建一个 LeafCollector，它可以 collect 没有依赖项的文件。HTTP/HTTPS 类型的文件
+// 在读取时才下载，不在创建时发送请求
+func NewLeafFile(parent, uri string, options ...Option) *LeafFile {
 	var updatedTimePtr *time.Time
-	if !strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
+	var fError error
+	if !utils.IsHTTPURI(uri) {
+		var reader io.ReadCloser
+		if reader, fError = utils.NewFileReader(uri); fError == nil {
+			reader.Close()
+		}
 		var fi os.FileInfo
 		if fError == nil {
-			if fi, fError = os.Stat(uri); fError != nil {
+			if fi, fError = os.Stat(uri); fError == nil {
 				updatedTime := fi.ModTime()
 				updatedTimePtr = &updatedTime
 			}
@@ -38,6 +43,7 @@ func NewLeafFile(parent, uri string) *LeafFile {
 
 	return &LeafFile{
 		FileAttrs: NewFileAttrs(parent, uri, Leaf, updatedTimePtr, fError),
+		configs:   newConfigs(options...),
 	}
 }
 
@@ -59,6 +65,23 @@ func (l *LeafFile) ReplaceDependencyURIs(base, objectKey string, mapper URIMappe
 	return nil
 }
 
+// Open Returns a reader of the file
+func (l *LeafFile) Open() (io.ReadCloser, error) {
+	if err := l.FileError(); err != nil {
+		return nil, err
+	}
+	return l.open()
+}
+
+// open Returns a reader of the file, remote files are downloaded by the
+// downloader of the configs
+func (l *LeafFile) open() (io.ReadCloser, error) {
+	if utils.IsHTTPURI(l.uri) {
+		return l.configs.HTTPDownloader.NewReader(l.configs.Context, l.uri)
+	}
+	return utils.NewLocalFileReader(l.uri)
+}
+
 // To Write the file to a new place
 func (l *LeafFile) To(uri string) error {
 	if err := l.FileError(); err != nil {
@@ -67,7 +90,12 @@ func (l *LeafFile) To(uri string) error {
 	if err := utils.CreateDirectory(filepath.Dir(uri)); err != nil {
 		return err
 	}
-	return utils.DownloadFile(l.uri, uri)
+	reader, err := l.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return utils.WriteReaderAtomic(uri, reader, 0777)
 }
 
 // ToOBS Write the file to bucket
@@ -78,6 +106,19 @@ func (l *LeafFile) ToOBS(bucket provider.Bucket, key string) error {
 	if bucket == nil {
 		return errors.New("bucket should not be nil")
 	}
+	if utils.IsHTTPURI(l.uri) {
+		reader, err := l.open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		_, err = bucket.PutObjectFromBytes(filepath.ToSlash(key), data)
+		return err
+	}
 	_, err := bucket.PutObjectFromFile(filepath.ToSlash(key), l.uri)
 	return err
 }
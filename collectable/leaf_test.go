@@ -1,6 +1,9 @@
 package collectable
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -32,3 +35,24 @@ func TestLeafFile(t *testing.T) {
 	err = os.Remove(TestImgTargetPath)
 	require.Nil(t, err)
 }
+
+func TestLeafFile_lazyRemote(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	// The file is downloaded when it is read, rather than when it is created
+	leaf := NewLeafFile("", server.URL+"/a.png")
+	require.Nil(t, leaf.FileError())
+	require.Zero(t, requests)
+
+	target := filepath.Join(t.TempDir(), "a.png")
+	require.Nil(t, leaf.To(target))
+	require.Equal(t, 1, requests)
+	data, err := ioutil.ReadFile(target)
+	require.Nil(t, err)
+	require.Equal(t, "content", string(data))
+}
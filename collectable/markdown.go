@@ -3,13 +3,11 @@ package collectable
 import (
 	"bytes"
 	"errors"
+	"io"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
 	"sync"
-	"time"
 
 	"github.com/slipfre/imgmd/provider"
 	"github.com/slipfre/imgmd/utils"
@@ -18,6 +16,9 @@ import (
 var imgRegex *regexp.Regexp
 var once sync.Once
 
+// stylesheetLinkRegex Stylesheets linked by html in markdown files
+var stylesheetLinkRegex = regexp.MustCompile(`<link\b[^>]*\bhref\s*=\s*(?:"(?P<uri>[^"]*)"|'(?P<uri>[^']*)')`)
+
 // GetMarkdownImgRegex 获取编译后的正则表达式
 func GetMarkdownImgRegex() *regexp.Regexp {
 	once.Do(func() {
@@ -26,41 +27,29 @@ func GetMarkdownImgRegex() *regexp.Regexp {
 	return imgRegex
 }
 
+func init() {
+	RegisterDocument(Markdown, func(parent, uri string, options ...Option) FileOperator {
+		return NewMarkdownFile(parent, uri, options...)
+	}, ".md")
+}
+
 // MarkdownFile Collectable files which is markdown format files
 type MarkdownFile struct {
 	*FileAttrs
-	buffer []byte
+	buffer       []byte
+	configs      *Configs
+	dependencies dependencyCache
 }
 
 // NewMarkdownFile Create a MarkdownFile object which is a collectable file for
 // Markdown file
-func NewMarkdownFile(parent, uri string) *MarkdownFile {
-	reader, fError := utils.NewFileReader(uri)
-	defer reader.Close()
-
-	var data []byte
-	if fError == nil {
-		data, fError = ioutil.ReadAll(reader)
-	}
-
-	var updatedTimePtr *time.Time
-	if !strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
-		var fi os.FileInfo
-		if fError == nil {
-			if fi, fError = os.Stat(uri); fError != nil {
-				updatedTime := fi.ModTime()
-				updatedTimePtr = &updatedTime
-			}
-		}
-
-		if absURI, err := filepath.Abs(uri); err == nil {
-			uri = absURI
-		}
-	}
-
+func NewMarkdownFile(parent, uri string, options ...Option) *MarkdownFile {
+	uri, data, updatedTime, fError := readFile(uri)
 	return &MarkdownFile{
-		FileAttrs: NewFileAttrs(parent, uri, Markdown, updatedTimePtr, fError),
-		buffer:    data,
+		FileAttrs:    NewFileAttrs(parent, uri, Markdown, updatedTime, fError),
+		buffer:       data,
+		configs:      newConfigs(options...),
+		dependencies: make(dependencyCache),
 	}
 }
 
@@ -71,39 +60,147 @@ func (m *MarkdownFile) FindDependencies() ([]FileOperator, error) {
 	}
 
 	dependencies := make([]FileOperator, 0, 3)
+	found := make(map[FileOperator]struct{})
+	add := func(dependency FileOperator) {
+		if _, ok := found[dependency]; !ok {
+			found[dependency] = struct{}{}
+			dependencies = append(dependencies, dependency)
+		}
+	}
 
 	matchs := GetMarkdownImgRegex().FindAllSubmatch(m.buffer, -1)
 	for _, match := range matchs {
-		path := string(match[2])
-		if !filepath.IsAbs(path) {
-			// TODO: what if path is a http or https url
-			path = filepath.Join(filepath.Dir(m.uri), path)
+		if dependency, ok := m.imgDependency(string(match[2])); ok {
+			add(dependency)
 		}
+	}
 
-		dependencies = append(dependencies, NewLeafFile(m.uri, path))
+	for _, ref := range regexReferenceFinder(stylesheetLinkRegex)(m.buffer, m.uri) {
+		add(m.dependency(ref.path))
+	}
+
+	for _, ref := range frontMatterReferences(m.buffer, m.uri, m.configs.FrontMatterKeys, m.configs.mirrorRemote()) {
+		add(m.dependency(ref.path))
 	}
 
 	return dependencies, nil
 }
 
-// ReplaceDependencyURIs Replace denpendency's uri in the file
+// ReplaceDependencyURIs Replace the uris of the dependencies by the uris
+// mapped by mapper
 func (m *MarkdownFile) ReplaceDependencyURIs(base, objectKey string, mapper URIMapper) error {
+	return m.ReplaceDependencies(base, objectKey, mapper.DependencyMapper())
+}
+
+// ReplaceDependencies Replace denpendency's uri in the file
+func (m *MarkdownFile) ReplaceDependencies(base, objectKey string, mapper DependencyMapper) error {
 	if err := m.FileError(); err != nil {
 		return err
 	}
 
+	m.replaceFrontMatter(base, objectKey, mapper)
+
 	m.buffer = GetMarkdownImgRegex().ReplaceAllFunc(
 		m.buffer,
 		func(match []byte) []byte {
 			subMatchs := GetMarkdownImgRegex().FindSubmatch(match)
-			newURI := mapper(Leaf, subMatchs[2], base, objectKey)
+			dependency, ok := m.imgDependency(string(subMatchs[2]))
+			if !ok {
+				return subMatchs[0]
+			}
+			newURI := mapper(dependency, base, objectKey)
 			return bytes.Replace(subMatchs[0], subMatchs[2], newURI, 1)
 		},
 	)
 
+	m.buffer = replaceReferences(
+		m.buffer,
+		regexReferenceFinder(stylesheetLinkRegex)(m.buffer, m.uri),
+		func(ref reference) []byte {
+			return mapper(m.dependency(ref.path), base, objectKey)
+		},
+	)
+
 	return nil
 }
 
+// replaceFrontMatter Replace the references in the front matter in place,
+// keeping the rest of the front matter as it is
+func (m *MarkdownFile) replaceFrontMatter(base, objectKey string, mapper DependencyMapper) {
+	frontMatterRefs := frontMatterReferences(m.buffer, m.uri, m.configs.FrontMatterKeys, m.configs.mirrorRemote())
+	if len(frontMatterRefs) == 0 {
+		return
+	}
+	refs := make([]reference, len(frontMatterRefs))
+	quoted := make(map[int]frontMatterReference, len(frontMatterRefs))
+	for i, ref := range frontMatterRefs {
+		refs[i] = ref.reference
+		quoted[ref.start] = ref
+	}
+	m.buffer = replaceReferences(m.buffer, refs, func(ref reference) []byte {
+		newURI := mapper(m.dependency(ref.path), base, objectKey)
+		if isEscaped(ref.uri) {
+			newURI = escapeLocalURI(newURI)
+		}
+		return quoted[ref.start].encode(newURI)
+	})
+}
+
+// imgDependency Returns the dependency referred by the uri of an image.
+// Returns false if the image is embedded as data uri and not extracted, or is
+// a remote image which is kept
+func (m *MarkdownFile) imgDependency(uri string) (FileOperator, bool) {
+	if utils.IsDataURI(uri) {
+		return m.embeddedFile(uri)
+	}
+	if utils.IsHTTPURI(uri) {
+		if !m.configs.mirrorRemote() {
+			return nil, false
+		}
+		return m.dependency(uri), true
+	}
+	path := uri
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(m.uri), path)
+	}
+	if m.configs.isAncestor(path) {
+		return nil, false
+	}
+	return m.dependency(path), true
+}
+
+// dependency Returns the dependency located at path
+func (m *MarkdownFile) dependency(path string) FileOperator {
+	return m.dependencies.get(path, func() FileOperator {
+		return NewFile(m.uri, path, m.configs.dependencyOptions(m.uri)...)
+	})
+}
+
+// embeddedFile Returns the standalone file of the image embedded as data uri,
+// which is named by the hash of its content. Returns false if embedded images
+// are not extracted or the data uri is invalid
+func (m *MarkdownFile) embeddedFile(dataURI string) (FileOperator, bool) {
+	if !m.configs.ExtractEmbedded {
+		return nil, false
+	}
+	data, mimeType, err := utils.DecodeDataURI(dataURI)
+	if err != nil {
+		return nil, false
+	}
+	path := filepath.Join(filepath.Dir(m.uri), EmbeddedFileName(data, mimeType))
+	return m.dependencies.get(path, func() FileOperator {
+		return NewEmbeddedFile(m.uri, path, data)
+	}), true
+}
+
+// Open Returns a reader of the buffer
+func (m *MarkdownFile) Open() (io.ReadCloser, error) {
+	if err := m.FileError(); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(m.buffer)), nil
+}
+
 // To Write the buffer to file
 func (m *MarkdownFile) To(uri string) error {
 	if err := m.FileError(); err != nil {
@@ -112,7 +209,7 @@ func (m *MarkdownFile) To(uri string) error {
 	if err := utils.CreateDirectory(filepath.Dir(uri)); err != nil {
 		return err
 	}
-	return ioutil.WriteFile(uri, m.buffer, 666)
+	return utils.WriteFileAtomic(uri, m.buffer, 0666)
 }
 
 // ToOBS Write the file to bucket
@@ -1,7 +1,9 @@
 package collectable
 
 import (
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -75,3 +77,38 @@ func TestMarkdownFile(t *testing.T) {
 	err = os.Remove(TestMDTargetPath)
 	require.Nil(t, err)
 }
+
+func TestMarkdownFile_extractDataURI(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\nfake")
+	dataURI := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	mdPath := filepath.Join(dir, "pasted.md")
+	writeTestFile(t, mdPath, "![Pasted]("+dataURI+")\n\n![Icon](data:image/svg+xml,%3Csvg%2F%3E)\n")
+	embeddedName := EmbeddedFileName(png, "image/png")
+
+	var collectableFile FileOperator = NewMarkdownFile("", mdPath)
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(dependencies))
+
+	collectableFile = NewMarkdownFile("", mdPath, WithExtractEmbedded(true))
+	dependencies, err = collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(dependencies))
+	require.Equal(t, filepath.Join(dir, embeddedName), dependencies[0].GetURI())
+	require.Equal(t, Leaf, dependencies[0].GetFileType())
+	require.Equal(t, ".svg", filepath.Ext(dependencies[1].GetURI()))
+
+	targetPath := filepath.Join(dir, "out", embeddedName)
+	require.Nil(t, dependencies[0].To(targetPath))
+	data, err := ioutil.ReadFile(targetPath)
+	require.Nil(t, err)
+	require.Equal(t, png, data)
+
+	err = collectableFile.ReplaceDependencyURIs(dir, "pasted.md", LocalURIMapper)
+	require.Nil(t, err)
+	require.Equal(t,
+		"![Pasted](pasted_medias/"+embeddedName+")\n\n![Icon](pasted_medias/"+filepath.Base(dependencies[1].GetURI())+")\n",
+		string(collectableFile.(*MarkdownFile).buffer),
+	)
+}
@@ -0,0 +1,125 @@
+package collectable
+
+import (
+	"context"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+// Configs Configurations for collectable files
+type Configs struct {
+	ExtractEmbedded bool
+	FrontMatterKeys []string
+	RemotePolicy    RemotePolicy
+	HTTPDownloader  *utils.HTTPDownloader
+	Context         context.Context
+	// ancestors are the uris of the files referring to the file, from the
+	// document
+	ancestors []string
+}
+
+// Option Options for collectable files
+type Option func(configs *Configs)
+
+// WithExtractEmbedded Option config for collectable files. If extract is true,
+// images embedded in the file, such as data uris in markdown files and
+// attachments and outputs of notebooks, are extracted to standalone
+// dependencies
+func WithExtractEmbedded(extract bool) Option {
+	return func(configs *Configs) {
+		configs.ExtractEmbedded = extract
+	}
+}
+
+// WithFrontMatterKeys Option config for collectable files. Values of the keys
+// in the front matter of markdown files are treated as references to their
+// dependencies, DefaultFrontMatterKeys by default
+func WithFrontMatterKeys(keys ...string) Option {
+	return func(configs *Configs) {
+		configs.FrontMatterKeys = keys
+	}
+}
+
+// WithRemotePolicy Option config for collectable files. It decides how
+// dependencies referred by http or https urls are collected, RemoteKeep by
+// default
+func WithRemotePolicy(policy RemotePolicy) Option {
+	return func(configs *Configs) {
+		configs.RemotePolicy = policy
+	}
+}
+
+// WithHTTPDownloader Option config for collectable files. Remote dependencies
+// are downloaded by downloader, which retries by the default policy if it is
+// nil
+func WithHTTPDownloader(downloader *utils.HTTPDownloader) Option {
+	return func(configs *Configs) {
+		configs.HTTPDownloader = downloader
+	}
+}
+
+// WithContext Option config for collectable files. Remote files are downloaded
+// with ctx when they are used before being fetched, context.Background() by
+// default
+func WithContext(ctx context.Context) Option {
+	return func(configs *Configs) {
+		configs.Context = ctx
+	}
+}
+
+// withAncestors Option config for the dependencies of files, ancestors are
+// the files referring to the dependency
+func withAncestors(ancestors []string) Option {
+	return func(configs *Configs) {
+		configs.ancestors = ancestors
+	}
+}
+
+func newConfigs(options ...Option) *Configs {
+	configs := &Configs{
+		ExtractEmbedded: false,
+		FrontMatterKeys: DefaultFrontMatterKeys,
+		RemotePolicy:    RemoteKeep,
+		Context:         context.Background(),
+	}
+	for _, option := range options {
+		option(configs)
+	}
+	return configs
+}
+
+// mirrorRemote Returns true if remote dependencies are collected
+func (c *Configs) mirrorRemote() bool {
+	return c.RemotePolicy == RemoteMirror
+}
+
+// isAncestor Returns true if the file located at path refers to the file, a
+// reference back to it is left as it is, otherwise the files are collected
+// along with each other endlessly
+func (c *Configs) isAncestor(path string) bool {
+	for _, ancestor := range c.ancestors {
+		if ancestor == path {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyOptions Returns the options of the dependencies of the file
+// located at uri
+func (c *Configs) dependencyOptions(uri string) []Option {
+	ancestors := make([]string, 0, len(c.ancestors)+1)
+	ancestors = append(append(ancestors, c.ancestors...), uri)
+	return append(c.options(), withAncestors(ancestors))
+}
+
+// options Returns options which reproduce the configs
+func (c *Configs) options() []Option {
+	return []Option{
+		WithExtractEmbedded(c.ExtractEmbedded),
+		WithFrontMatterKeys(c.FrontMatterKeys...),
+		WithRemotePolicy(c.RemotePolicy),
+		WithHTTPDownloader(c.HTTPDownloader),
+		WithContext(c.Context),
+	}
+}
@@ -0,0 +1,50 @@
+package collectable
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+	// Links to local files, the other links such as '[[heading]]' are internal
+	// links of org
+	orgLinkRegex        = regexp.MustCompile(`\[\[(?:file:(?P<uri>[^\]\[:]+)|(?P<uri>\.{0,2}/[^\]\[:]+))(?:::[^\]\[]*)?\]`)
+	orgDescriptionRegex = regexp.MustCompile(`\]\[file:(?P<uri>[^\]\[:]+)\]\]`)
+	orgIncludeRegex     = regexp.MustCompile(`(?mi)^[ \t]*#\+INCLUDE:[ \t]+(?:"(?P<uri>[^"]+?)(?:::[^"]*)?"|(?P<uri>[^"\s]+))`)
+)
+
+func init() {
+	RegisterDocument(Org, func(parent, uri string, options ...Option) FileOperator {
+		return NewOrgFile(parent, uri, options...)
+	}, ".org")
+}
+
+// OrgFile Collectable files which is Emacs Org format. Files linked by
+// '[[file:...]]' and '[[./...]]' and included by '#+INCLUDE:' are its
+// dependencies
+type OrgFile struct {
+	*textFile
+}
+
+// NewOrgFile Create a OrgFile object which is a collectable file for Org file
+func NewOrgFile(parent, uri string, options ...Option) *OrgFile {
+	o := &OrgFile{
+		textFile: newTextFile(parent, uri, Org, regexReferenceFinder(orgLinkRegex, orgDescriptionRegex, orgIncludeRegex), options...),
+	}
+	o.format = formatOrgLink
+	return o
+}
+
+// formatOrgLink Keep links without 'file:' starting with './', otherwise org
+// takes them as internal links
+func formatOrgLink(buffer []byte, ref reference, newURI []byte) []byte {
+	if !bytes.HasSuffix(buffer[:ref.start], []byte("[[")) {
+		return newURI
+	}
+	if schemeRegex.Match(newURI) || filepath.IsAbs(string(newURI)) ||
+		bytes.HasPrefix(newURI, []byte("./")) || bytes.HasPrefix(newURI, []byte("../")) {
+		return newURI
+	}
+	return append([]byte("./"), newURI...)
+}
@@ -0,0 +1,69 @@
+package collectable
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrgFile(t *testing.T) {
+	dir := t.TempDir()
+	orgPath := filepath.Join(dir, "notes.org")
+	writeTestFile(t, orgPath, `#+TITLE: Notes
+#+INCLUDE: "chapters/setup.org::*Install" :minlevel 2
+
+* Screens
+[[file:img/x.png]]
+[[./y.png][caption]]
+[[file:big.png][file:thumb.png]]
+[[Screens]] and [[https://orgmode.org][Org]]
+`)
+	writeTestFile(t, filepath.Join(dir, "chapters", "setup.org"), "[[file:../img/setup.png]]\n")
+
+	var collectableFile FileOperator = NewOrgFile("", orgPath)
+	require.Nil(t, collectableFile.FileError())
+	require.Equal(t, Org, collectableFile.GetFileType())
+
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	uris := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		uris = append(uris, dependency.GetURI())
+	}
+	require.ElementsMatch(t, []string{
+		filepath.Join(dir, "chapters", "setup.org"),
+		filepath.Join(dir, "img", "x.png"),
+		filepath.Join(dir, "y.png"),
+		filepath.Join(dir, "big.png"),
+		filepath.Join(dir, "thumb.png"),
+	}, uris)
+
+	err = collectableFile.ReplaceDependencyURIs(dir, "notes.org", LocalURIMapper)
+	require.Nil(t, err)
+	require.Equal(t, `#+TITLE: Notes
+#+INCLUDE: "notes_medias/setup.org::*Install" :minlevel 2
+
+* Screens
+[[file:notes_medias/x.png]]
+[[./notes_medias/y.png][caption]]
+[[file:notes_medias/big.png][file:notes_medias/thumb.png]]
+[[Screens]] and [[https://orgmode.org][Org]]
+`, string(collectableFile.(*OrgFile).buffer))
+}
+
+func TestOrgFile_cycle(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.org"), "[[file:b.org]] [[file:a.png]]\n")
+	writeTestFile(t, filepath.Join(dir, "b.org"), "[[file:a.org]] [[file:b.png]]\n")
+
+	// The link back to the file referring to b.org is not a dependency
+	deps, err := NewOrgFile("", filepath.Join(dir, "a.org")).FindDependencies()
+	require.Nil(t, err)
+	require.Len(t, deps, 2)
+	require.Equal(t, filepath.Join(dir, "b.org"), deps[0].GetURI())
+	nested, err := deps[0].FindDependencies()
+	require.Nil(t, err)
+	require.Len(t, nested, 1)
+	require.Equal(t, filepath.Join(dir, "b.png"), nested[0].GetURI())
+}
@@ -0,0 +1,129 @@
+package collectable
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+// Constructor Create a collectable file of a file type
+type Constructor func(parent, uri string, options ...Option) FileOperator
+
+// registration How files of a file type are collected
+type registration struct {
+	constructor Constructor
+	// document is true if files of the type can be collected by themselves
+	document bool
+}
+
+var registry = struct {
+	sync.RWMutex
+	types      map[FileType]registration
+	extensions map[string]FileType
+}{
+	types:      make(map[FileType]registration),
+	extensions: make(map[string]FileType),
+}
+
+// Register Register the constructor of files of the file type, which are
+// recognized by the extensions. Files of the type are collected as
+// dependencies only, such as stylesheets and svg images. Registering a type or
+// an extension again replaces the previous one. The returned unregister
+// restores the type and the extensions to what they were before
+func Register(fileType FileType, constructor Constructor, extensions ...string) (unregister func()) {
+	return register(fileType, registration{constructor: constructor}, extensions)
+}
+
+// RegisterDocument Register the constructor of documents of the file type,
+// which are recognized by the extensions. Documents can be collected by
+// themselves and selected by the '--type' flag
+func RegisterDocument(fileType FileType, constructor Constructor, extensions ...string) (unregister func()) {
+	return register(fileType, registration{constructor: constructor, document: true}, extensions)
+}
+
+func register(fileType FileType, r registration, extensions []string) func() {
+	registry.Lock()
+	defer registry.Unlock()
+	previous, registered := registry.types[fileType]
+	previousTypes := make(map[string]FileType)
+	registry.types[fileType] = r
+	for _, ext := range extensions {
+		ext = strings.ToLower(ext)
+		if previousType, ok := registry.extensions[ext]; ok {
+			previousTypes[ext] = previousType
+		}
+		registry.extensions[ext] = fileType
+	}
+
+	return func() {
+		registry.Lock()
+		defer registry.Unlock()
+		if registered {
+			registry.types[fileType] = previous
+		} else {
+			delete(registry.types, fileType)
+		}
+		for _, ext := range extensions {
+			ext = strings.ToLower(ext)
+			if previousType, ok := previousTypes[ext]; ok {
+				registry.extensions[ext] = previousType
+			} else {
+				delete(registry.extensions, ext)
+			}
+		}
+	}
+}
+
+// IsDocumentType Returns true if the file type is registered as document
+func IsDocumentType(fileType FileType) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.types[fileType].document
+}
+
+// DocumentTypes Returns all the registered document types in order
+func DocumentTypes() []FileType {
+	registry.RLock()
+	defer registry.RUnlock()
+	types := make([]FileType, 0, len(registry.types))
+	for fileType, r := range registry.types {
+		if r.document {
+			types = append(types, fileType)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// FileTypeOf Returns the file type of the file located at uri, which is
+// decided by the extension of uri. Returns Leaf for unknown extensions
+func FileTypeOf(uri string) FileType {
+	registry.RLock()
+	defer registry.RUnlock()
+	if fileType, ok := registry.extensions[strings.ToLower(filepath.Ext(uri))]; ok {
+		return fileType
+	}
+	return Leaf
+}
+
+// NewFile Create a collectable file for the file located at uri according to
+// its file type. Files which have dependencies themselves, such as
+// stylesheets and svg images, are collected recursively, the others are
+// collected as LeafFile. Files at http or https urls are downloaded as
+// RemoteFile
+func NewFile(parent, uri string, options ...Option) FileOperator {
+	if utils.IsHTTPURI(uri) {
+		return NewRemoteFile(parent, uri, options...)
+	}
+	fileType := FileTypeOf(uri)
+	registry.RLock()
+	r, ok := registry.types[fileType]
+	registry.RUnlock()
+	if ok && r.constructor != nil {
+		return r.constructor(parent, uri, options...)
+	}
+	return NewLeafFile(parent, uri, options...)
+}
@@ -0,0 +1,54 @@
+package collectable
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	require.Equal(t, Markdown, FileTypeOf("a/b.MD"))
+	require.Equal(t, AsciiDoc, FileTypeOf("b.adoc"))
+	require.Equal(t, CSS, FileTypeOf("b.css"))
+	require.Equal(t, Leaf, FileTypeOf("b.png"))
+
+	require.True(t, IsDocumentType(Markdown))
+	require.True(t, IsDocumentType(TeX))
+	require.False(t, IsDocumentType(CSS))
+	require.False(t, IsDocumentType(Leaf))
+	require.Subset(t, DocumentTypes(), []FileType{Markdown, IPYNB, RST, AsciiDoc, TeX, Org})
+	require.NotContains(t, DocumentTypes(), SVG)
+
+	// Register a new document type which is collected as rst
+	const Text FileType = "test-text"
+	unregister := RegisterDocument(Text, func(parent, uri string, options ...Option) FileOperator {
+		return &RSTFile{
+			textFile: newTextFile(parent, uri, Text, regexReferenceFinder(rstImageRegex), options...),
+		}
+	}, ".TestText", ".rst")
+	t.Cleanup(func() {
+		unregister()
+		require.Equal(t, RST, FileTypeOf("guide.rst"))
+		require.Equal(t, Leaf, FileTypeOf("notes.testtext"))
+		require.False(t, IsDocumentType(Text))
+	})
+
+	dir := t.TempDir()
+	textPath := filepath.Join(dir, "notes.testtext")
+	writeTestFile(t, textPath, ".. image:: a.png\n")
+	writeTestFile(t, filepath.Join(dir, "a.png"), "a")
+
+	require.Equal(t, Text, FileTypeOf(textPath))
+	require.Equal(t, Text, FileTypeOf("guide.rst"))
+	require.True(t, IsDocumentType(Text))
+	require.Contains(t, DocumentTypes(), Text)
+
+	collectableFile := NewFile("", textPath)
+	require.Nil(t, collectableFile.FileError())
+	require.Equal(t, Text, collectableFile.GetFileType())
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(dependencies))
+	require.Equal(t, filepath.Join(dir, "a.png"), dependencies[0].GetURI())
+}
@@ -0,0 +1,190 @@
+package collectable
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slipfre/imgmd/provider"
+	"github.com/slipfre/imgmd/utils"
+)
+
+// RemotePolicy How remote dependencies referred by http or https urls are
+// collected
+type RemotePolicy string
+
+const (
+	// RemoteMirror Download remote dependencies and collect them as the local
+	// ones
+	RemoteMirror RemotePolicy = "mirror"
+	// RemoteKeep Leave the urls of remote dependencies untouched
+	RemoteKeep RemotePolicy = "keep"
+)
+
+// RemoteFile Collectable file which is downloaded from a http or https url and
+// has no dependencies. The file is downloaded by Fetch, or on its first use
+// with the context of the options
+type RemoteFile struct {
+	*FileAttrs
+	configs *Configs
+	once    sync.Once
+	data    []byte
+	name    string
+}
+
+// NewRemoteFile Create a RemoteFile object which downloads the file at uri. The
+// name of the collected file is decided by the sniffed MIME type of the content
+func NewRemoteFile(parent, uri string, options ...Option) *RemoteFile {
+	return &RemoteFile{
+		FileAttrs: NewFileAttrs(parent, uri, Leaf, nil, nil),
+		configs:   newConfigs(options...),
+	}
+}
+
+// Fetch Download the file unless it has been downloaded, and returns the error
+// of downloading. The download stops once ctx is cancelled
+func (r *RemoteFile) Fetch(ctx context.Context) error {
+	r.once.Do(func() {
+		data, header, err := r.configs.HTTPDownloader.Fetch(ctx, r.uri)
+		if err != nil {
+			r.err = err
+			return
+		}
+		if updatedTime, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+			r.updatedTime = &updatedTime
+		}
+		r.data = data
+		r.name = remoteFileName(r.uri, data, header.Get("Content-Type"))
+	})
+	return r.err
+}
+
+// Name Returns the name of the collected file
+func (r *RemoteFile) Name() string {
+	if r.Fetch(r.configs.Context) != nil {
+		return remoteFileName(r.uri, nil, "")
+	}
+	return r.name
+}
+
+// FileError Get the error of downloading the file
+func (r *RemoteFile) FileError() error {
+	return r.Fetch(r.configs.Context)
+}
+
+// GetUpdatedTime Get the last modified time of the downloaded file
+func (r *RemoteFile) GetUpdatedTime() (*time.Time, error) {
+	r.Fetch(r.configs.Context)
+	return r.FileAttrs.GetUpdatedTime()
+}
+
+// IsUpdatedSince Returns true if the downloaded file has updated since the time,
+// or if either time is unknown
+func (r *RemoteFile) IsUpdatedSince(time *time.Time) (bool, error) {
+	r.Fetch(r.configs.Context)
+	return r.FileAttrs.IsUpdatedSince(time)
+}
+
+// FindDependencies Returns all the dependencies
+func (r *RemoteFile) FindDependencies() ([]FileOperator, error) {
+	if err := r.FileError(); err != nil {
+		return nil, err
+	}
+	return make([]FileOperator, 0), nil
+}
+
+// ReplaceDependencyURIs Replaces all the dependencies uri in the file
+func (r *RemoteFile) ReplaceDependencyURIs(base, objectKey string, mapper URIMapper) error {
+	return r.FileError()
+}
+
+// Open Returns a reader of the downloaded content
+func (r *RemoteFile) Open() (io.ReadCloser, error) {
+	if err := r.FileError(); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(r.data)), nil
+}
+
+// To Write the downloaded content to file
+func (r *RemoteFile) To(uri string) error {
+	if err := r.FileError(); err != nil {
+		return err
+	}
+	if err := utils.CreateDirectory(filepath.Dir(uri)); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(uri, r.data, 0666)
+}
+
+// ToOBS Write the downloaded content to bucket
+func (r *RemoteFile) ToOBS(bucket provider.Bucket, key string) error {
+	if err := r.FileError(); err != nil {
+		return err
+	}
+	if bucket == nil {
+		return errors.New("bucket should not be nil")
+	}
+	_, err := bucket.PutObjectFromBytes(filepath.ToSlash(key), r.data)
+	return err
+}
+
+// remoteFileName Returns the name of the file downloaded from uri. The
+// extension is decided by the sniffed MIME type, and the response header if
+// sniffing tells nothing. Urls with queries are distinguished by their hashes
+func remoteFileName(uri string, data []byte, contentType string) string {
+	sum := sha256.Sum256([]byte(uri))
+	hash := hex.EncodeToString(sum[:4])
+
+	name := ""
+	u, err := url.Parse(uri)
+	if err == nil {
+		name = path.Base(u.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = hash
+	} else if err == nil && u.RawQuery != "" {
+		ext := path.Ext(name)
+		name = strings.TrimSuffix(name, ext) + "-" + hash + ext
+	}
+
+	mimeType := sniffMIMEType(data, contentType)
+	if mimeType == "" {
+		return name
+	}
+	ext := path.Ext(name)
+	if extType, _, err := mime.ParseMediaType(mime.TypeByExtension(ext)); err == nil && extType == mimeType {
+		return name
+	}
+	return name + utils.ExtensionByMIMEType(mimeType)
+}
+
+// sniffMIMEType Returns the MIME type of data without parameters, "" if it is
+// unknown
+func sniffMIMEType(data []byte, contentType string) string {
+	candidates := []string{http.DetectContentType(data), contentType}
+	for _, candidate := range candidates {
+		mediaType, _, err := mime.ParseMediaType(candidate)
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/octet-stream", "text/plain", "text/xml", "application/xml":
+			continue
+		}
+		return mediaType
+	}
+	return ""
+}
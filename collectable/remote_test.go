@@ -0,0 +1,128 @@
+package collectable
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testPNG A 1x1 png image
+var testPNG, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==")
+
+func newTestImageServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/avatar", "/img/logo.png":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(testPNG)
+		case "/diagram":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRemoteFile(t *testing.T) {
+	server := newTestImageServer(t)
+
+	remote := NewRemoteFile("", server.URL+"/avatar")
+	require.Nil(t, remote.FileError())
+	require.Equal(t, Leaf, remote.GetFileType())
+	require.Equal(t, "avatar.png", FileName(remote))
+
+	remote = NewRemoteFile("", server.URL+"/img/logo.png")
+	require.Equal(t, "logo.png", FileName(remote))
+
+	remote = NewRemoteFile("", server.URL+"/diagram")
+	require.Equal(t, "diagram.svg", FileName(remote))
+
+	first := NewRemoteFile("", server.URL+"/avatar?size=64")
+	second := NewRemoteFile("", server.URL+"/avatar?size=128")
+	require.NotEqual(t, FileName(first), FileName(second))
+	require.Equal(t, ".png", filepath.Ext(FileName(first)))
+
+	targetPath := filepath.Join(t.TempDir(), "avatar.png")
+	require.Nil(t, first.To(targetPath))
+	require.FileExists(t, targetPath)
+
+	missing := NewRemoteFile("", server.URL+"/missing.png")
+	require.NotNil(t, missing.FileError())
+}
+
+func TestMarkdownFile_remoteDependencies(t *testing.T) {
+	server := newTestImageServer(t)
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "doc.md")
+	content := "![remote](" + server.URL + "/avatar)\n![local](local.png)\n"
+	writeTestFile(t, mdPath, content)
+	writeTestFile(t, filepath.Join(dir, "local.png"), "local")
+
+	collectableFile := NewMarkdownFile("", mdPath, WithRemotePolicy(RemoteMirror))
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(dependencies))
+	require.Equal(t, server.URL+"/avatar", dependencies[0].GetURI())
+	require.Nil(t, dependencies[0].FileError())
+
+	err = collectableFile.ReplaceDependencies(dir, "doc.md", NewLocalDependencyMapper(DependencyKey))
+	require.Nil(t, err)
+	require.Equal(t, "![remote]("+filepath.Join("doc_medias", "avatar.png")+")\n![local]("+filepath.Join("doc_medias", "local.png")+")\n", string(collectableFile.buffer))
+
+	collectableFile = NewMarkdownFile("", mdPath, WithRemotePolicy(RemoteKeep))
+	dependencies, err = collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(dependencies))
+
+	err = collectableFile.ReplaceDependencies(dir, "doc.md", NewLocalDependencyMapper(DependencyKey))
+	require.Nil(t, err)
+	require.Equal(t, "![remote]("+server.URL+"/avatar)\n![local]("+filepath.Join("doc_medias", "local.png")+")\n", string(collectableFile.buffer))
+}
+
+func TestCSSFile_remoteDependencies(t *testing.T) {
+	server := newTestImageServer(t)
+	dir := t.TempDir()
+	cssPath := filepath.Join(dir, "style.css")
+	writeTestFile(t, cssPath, "body { background: url("+server.URL+"/img/logo.png?v=2); }")
+
+	collectableFile := NewCSSFile("", cssPath, WithRemotePolicy(RemoteMirror))
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(dependencies))
+	require.Equal(t, server.URL+"/img/logo.png?v=2", dependencies[0].GetURI())
+
+	collectableFile = NewCSSFile("", cssPath)
+	dependencies, err = collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(dependencies))
+}
+
+func TestRemoteFile_context(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(testPNG)
+	}))
+	t.Cleanup(server.Close)
+
+	// A file used before being fetched is downloaded with the context of the
+	// options, which stops it once the run is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	remote := NewRemoteFile("", server.URL+"/avatar", WithContext(ctx))
+	require.NotNil(t, remote.FileError())
+	require.Equal(t, int32(0), atomic.LoadInt32(&requests))
+
+	remote = NewRemoteFile("", server.URL+"/avatar", WithContext(context.Background()))
+	require.Nil(t, remote.FileError())
+	require.Equal(t, "avatar.png", FileName(remote))
+}
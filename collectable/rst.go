@@ -0,0 +1,26 @@
+package collectable
+
+import "regexp"
+
+var rstImageRegex = regexp.MustCompile(`(?m)^[ \t]*\.\.[ \t]+(?:\|[^|\n]+\|[ \t]+)?(?:image|figure)::[ \t]+(?P<uri>\S+)`)
+
+func init() {
+	RegisterDocument(RST, func(parent, uri string, options ...Option) FileOperator {
+		return NewRSTFile(parent, uri, options...)
+	}, ".rst", ".rest")
+}
+
+// RSTFile Collectable files which is reStructuredText format. Images referred
+// by 'image', 'figure' and substitution 'image' directives are its
+// dependencies
+type RSTFile struct {
+	*textFile
+}
+
+// NewRSTFile Create a RSTFile object which is a collectable file for
+// reStructuredText file
+func NewRSTFile(parent, uri string, options ...Option) *RSTFile {
+	return &RSTFile{
+		textFile: newTextFile(parent, uri, RST, regexResourceFinder(rstImageRegex), options...),
+	}
+}
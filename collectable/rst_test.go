@@ -0,0 +1,58 @@
+package collectable
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSTFile(t *testing.T) {
+	dir := t.TempDir()
+	rstPath := filepath.Join(dir, "guide.rst")
+	writeTestFile(t, rstPath, `Guide
+=====
+
+.. image:: img/install.png
+   :alt: Install
+
+.. figure:: img/arch.svg
+
+   Architecture
+
+The |logo| is ours.
+
+.. |logo| image:: img/logo.png
+.. image:: https://example.com/badge.svg
+`)
+
+	var collectableFile FileOperator = NewRSTFile("", rstPath)
+	require.Nil(t, collectableFile.FileError())
+	require.Equal(t, RST, collectableFile.GetFileType())
+
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	require.Equal(t, 3, len(dependencies))
+	require.Equal(t, filepath.Join(dir, "img", "install.png"), dependencies[0].GetURI())
+	require.Equal(t, filepath.Join(dir, "img", "arch.svg"), dependencies[1].GetURI())
+	require.Equal(t, SVG, dependencies[1].GetFileType())
+	require.Equal(t, filepath.Join(dir, "img", "logo.png"), dependencies[2].GetURI())
+
+	err = collectableFile.ReplaceDependencyURIs(dir, "guide.rst", LocalURIMapper)
+	require.Nil(t, err)
+	require.Equal(t, `Guide
+=====
+
+.. image:: guide_medias/install.png
+   :alt: Install
+
+.. figure:: guide_medias/arch.svg
+
+   Architecture
+
+The |logo| is ours.
+
+.. |logo| image:: guide_medias/logo.png
+.. image:: https://example.com/badge.svg
+`, string(collectableFile.(*RSTFile).buffer))
+}
@@ -0,0 +1,24 @@
+package collectable
+
+import "regexp"
+
+var svgHrefRegex = regexp.MustCompile(`\s(?:xlink:)?href\s*=\s*(?:"(?P<uri>[^"]*)"|'(?P<uri>[^']*)')`)
+
+func init() {
+	Register(SVG, func(parent, uri string, options ...Option) FileOperator {
+		return NewSVGFile(parent, uri, options...)
+	}, ".svg")
+}
+
+// SVGFile Collectable files which is svg image. Images and stylesheets
+// referred by 'href', 'xlink:href' and 'url(...)' are its dependencies
+type SVGFile struct {
+	*textFile
+}
+
+// NewSVGFile Create a SVGFile object which is a collectable file for svg image
+func NewSVGFile(parent, uri string, options ...Option) *SVGFile {
+	return &SVGFile{
+		textFile: newTextFile(parent, uri, SVG, regexReferenceFinder(svgHrefRegex, cssURLRegex), options...),
+	}
+}
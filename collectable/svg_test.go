@@ -0,0 +1,53 @@
+package collectable
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSVGFile(t *testing.T) {
+	dir := t.TempDir()
+	svgPath := filepath.Join(dir, "diagram.svg")
+	writeTestFile(t, svgPath, `<?xml-stylesheet type="text/css" href="diagram.css"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+  <defs><linearGradient id="g"/></defs>
+  <image href="shots/login.png" x="0"/>
+  <image xlink:href='shots/home.png'/>
+  <use href="#g"/>
+  <a href="https://example.com/"><rect style="fill: url(#g)"/></a>
+  <rect style="fill: url(textures/paper.jpg)"/>
+</svg>
+`)
+
+	var collectableFile FileOperator = NewSVGFile("", svgPath)
+	require.Nil(t, collectableFile.FileError())
+	require.Equal(t, SVG, collectableFile.GetFileType())
+
+	dependencies, err := collectableFile.FindDependencies()
+	require.Nil(t, err)
+	uris := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		uris = append(uris, dependency.GetURI())
+	}
+	require.ElementsMatch(t, []string{
+		filepath.Join(dir, "diagram.css"),
+		filepath.Join(dir, "shots", "login.png"),
+		filepath.Join(dir, "shots", "home.png"),
+		filepath.Join(dir, "textures", "paper.jpg"),
+	}, uris)
+
+	err = collectableFile.ReplaceDependencyURIs(dir, "diagram.svg", LocalURIMapper)
+	require.Nil(t, err)
+	require.Equal(t, `<?xml-stylesheet type="text/css" href="diagram_medias/diagram.css"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+  <defs><linearGradient id="g"/></defs>
+  <image href="diagram_medias/login.png" x="0"/>
+  <image xlink:href='diagram_medias/home.png'/>
+  <use href="#g"/>
+  <a href="https://example.com/"><rect style="fill: url(#g)"/></a>
+  <rect style="fill: url(diagram_medias/paper.jpg)"/>
+</svg>
+`, string(collectableFile.(*SVGFile).buffer))
+}
@@ -0,0 +1,195 @@
+package collectable
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+// templateVariables The variables of key templates, which are evaluated with
+// the dependency and the object key of the file referring to it
+var templateVariables = map[string]func(ctx *templateContext) (string, bool){
+	// docKey The object key of the referring file without extension
+	"docKey": func(ctx *templateContext) (string, bool) {
+		return strings.TrimSuffix(ctx.objectKey, filepath.Ext(ctx.objectKey)), true
+	},
+	// medias The default media directory of the referring file, 'docKey_medias'
+	"medias": func(ctx *templateContext) (string, bool) {
+		return utils.GetTargetResourcesDirPath(ctx.objectKey), true
+	},
+	// basename The file name of the dependency
+	"basename": func(ctx *templateContext) (string, bool) {
+		return FileName(ctx.dep), true
+	},
+	// name The file name of the dependency without extension
+	"name": func(ctx *templateContext) (string, bool) {
+		name := FileName(ctx.dep)
+		return strings.TrimSuffix(name, filepath.Ext(name)), true
+	},
+	// ext The extension of the dependency, with the leading dot
+	"ext": func(ctx *templateContext) (string, bool) {
+		return filepath.Ext(FileName(ctx.dep)), true
+	},
+	// sha256 The hex encoded sha256 hash of the content of the dependency
+	"sha256": func(ctx *templateContext) (string, bool) {
+		return ctx.hasher.Hash(ctx.dep)
+	},
+	// yyyy The year the dependency was updated, or the current year if unknown
+	"yyyy": func(ctx *templateContext) (string, bool) {
+		return ctx.updatedTime().Format("2006"), true
+	},
+	// mm The month the dependency was updated
+	"mm": func(ctx *templateContext) (string, bool) {
+		return ctx.updatedTime().Format("01"), true
+	},
+	// dd The day the dependency was updated
+	"dd": func(ctx *templateContext) (string, bool) {
+		return ctx.updatedTime().Format("02"), true
+	},
+	// type The file type of the dependency
+	"type": func(ctx *templateContext) (string, bool) {
+		return string(ctx.dep.GetFileType()), true
+	},
+}
+
+type templateContext struct {
+	dep       FileOperator
+	objectKey string
+	hasher    *contentHasher
+}
+
+func (ctx *templateContext) updatedTime() time.Time {
+	if updatedTime, err := ctx.dep.GetUpdatedTime(); err == nil && updatedTime != nil {
+		return *updatedTime
+	}
+	return time.Now()
+}
+
+// templateSegment A literal text, or a variable truncated to length if length
+// is positive
+type templateSegment struct {
+	literal  string
+	variable string
+	length   int
+}
+
+// NewTemplateKey Returns a KeyFunc which collects the dependencies to the keys
+// rendered from the template, such as '{medias}/{basename}', which is the
+// default layout, or 'images/{yyyy}/{mm}/{sha256:12}{ext}'. The variables are
+// docKey, medias, basename, name, ext, sha256, yyyy, mm, dd and type, and
+// '{variable:N}' keeps the first N characters of the value. Dependencies
+// rendered to the same key are collected to distinct keys by a KeyAssigner of
+// the KeyFunc, unless the key addresses the content by the whole sha256, so a
+// KeyFunc should be created for each run. Dependencies which can not be
+// rendered, or are rendered to keys with '..', are collected by DependencyKey
+func NewTemplateKey(template string) (KeyFunc, error) {
+	segments, err := parseTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	if hasParentSegment(filepath.ToSlash(render(segments, func(segment templateSegment) string { return "x" }))) {
+		return nil, fmt.Errorf("'..' in key template '%s'", template)
+	}
+	hasher := newContentHasher()
+	key := func(dep FileOperator, base, objectKey string) string {
+		ctx := &templateContext{dep: dep, objectKey: objectKey, hasher: hasher}
+		rendered := true
+		key := render(segments, func(segment templateSegment) string {
+			value, ok := templateVariables[segment.variable](ctx)
+			rendered = rendered && ok
+			if segment.length > 0 && segment.length < len(value) {
+				value = value[:segment.length]
+			}
+			return filepath.ToSlash(value)
+		})
+		// The key should not escape the prefix or the directory of the
+		// template
+		if !rendered || hasParentSegment(filepath.ToSlash(key)) {
+			return DependencyKey(dep, base, objectKey)
+		}
+		return filepath.FromSlash(strings.TrimLeft(filepath.ToSlash(filepath.Clean(key)), "/"))
+	}
+	for _, segment := range segments {
+		if segment.variable == "sha256" && (segment.length == 0 || segment.length >= sha256.Size*2) {
+			return key, nil
+		}
+	}
+	return NewKeyAssigner(key).Key, nil
+}
+
+// render Returns the template with the variables replaced by value
+func render(segments []templateSegment, value func(segment templateSegment) string) string {
+	rendered := strings.Builder{}
+	for _, segment := range segments {
+		if segment.variable == "" {
+			rendered.WriteString(segment.literal)
+			continue
+		}
+		rendered.WriteString(value(segment))
+	}
+	return rendered.String()
+}
+
+// hasParentSegment Returns true if the slash separated key has a '..' segment
+func hasParentSegment(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTemplate Split the template into literals and variables
+func parseTemplate(template string) ([]templateSegment, error) {
+	if strings.TrimSpace(template) == "" {
+		return nil, fmt.Errorf("empty key template")
+	}
+	segments := make([]templateSegment, 0)
+	rest := template
+	for rest != "" {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			segments = append(segments, templateSegment{literal: rest})
+			break
+		}
+		if rest[start] == '}' {
+			return nil, fmt.Errorf("unexpected '}' in key template '%s'", template)
+		}
+		if start > 0 {
+			segments = append(segments, templateSegment{literal: rest[:start]})
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed '{' in key template '%s'", template)
+		}
+		segment, err := parseTemplateVariable(rest[start+1 : start+end])
+		if err != nil {
+			return nil, fmt.Errorf("%s in key template '%s'", err.Error(), template)
+		}
+		segments = append(segments, segment)
+		rest = rest[start+end+1:]
+	}
+	return segments, nil
+}
+
+// parseTemplateVariable Parse 'variable' or 'variable:N'
+func parseTemplateVariable(s string) (templateSegment, error) {
+	segment := templateSegment{variable: s}
+	if i := strings.Index(s, ":"); i >= 0 {
+		length, err := strconv.Atoi(s[i+1:])
+		if err != nil || length <= 0 {
+			return segment, fmt.Errorf("invalid length of '{%s}'", s)
+		}
+		segment.variable, segment.length = s[:i], length
+	}
+	if _, ok := templateVariables[segment.variable]; !ok {
+		return segment, fmt.Errorf("unknown variable '{%s}'", segment.variable)
+	}
+	return segment, nil
+}
@@ -0,0 +1,95 @@
+package collectable
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTemplateKey(t *testing.T) {
+	dir := t.TempDir()
+	mdPath := filepath.Join(dir, "doc.md")
+	writeTestFile(t, mdPath, "![a](a/shot.png) ![b](b/shot.png)\n")
+	writeTestFile(t, filepath.Join(dir, "a", "shot.png"), "a")
+	writeTestFile(t, filepath.Join(dir, "b", "shot.png"), "b")
+
+	deps, err := NewMarkdownFile("", mdPath).FindDependencies()
+	require.Nil(t, err)
+	require.Len(t, deps, 2)
+
+	key, err := NewTemplateKey("images/{yyyy}/{mm}/{dd}/{sha256:12}{ext}")
+	require.Nil(t, err)
+	sum := sha256.Sum256([]byte("a"))
+	dated := &datedFile{FileOperator: deps[0], updatedTime: time.Date(2020, 3, 7, 0, 0, 0, 0, time.Local)}
+	require.Equal(t, filepath.Join("images", "2020", "03", "07", hex.EncodeToString(sum[:])[:12]+".png"), key(dated, dir, "docs/doc.md"))
+
+	key, err = NewTemplateKey("{docKey}/{type}/{name}{ext}")
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join("docs", "doc", "leaf", "shot.png"), key(deps[0], dir, filepath.Join("docs", "doc.md")))
+	// Distinct files rendered to the same key are collected to distinct keys
+	require.NotEqual(t, key(deps[0], dir, filepath.Join("docs", "doc.md")), key(deps[1], dir, filepath.Join("docs", "doc.md")))
+
+	key, err = NewTemplateKey("{medias}/{basename}")
+	require.Nil(t, err)
+	require.Equal(t, DependencyKey(deps[0], dir, "doc.md"), key(deps[0], dir, "doc.md"))
+
+	// Keys escaping the directory they are rendered in are left to
+	// DependencyKey
+	key, err = NewTemplateKey("{docKey}/{basename}")
+	require.Nil(t, err)
+	require.Equal(t, DependencyKey(deps[0], dir, filepath.Join("..", "doc.md")), key(deps[0], dir, filepath.Join("..", "doc.md")))
+	key, err = NewTemplateKey("{name}..{ext}")
+	require.Nil(t, err)
+	require.Equal(t, "shot...png", key(deps[0], dir, "doc.md"))
+
+	for _, template := range []string{"", "{unknown}", "{name", "name}", "{sha256:0}", "{sha256:x}", "../{basename}", "{medias}/../{basename}", ".."} {
+		_, err = NewTemplateKey(template)
+		require.NotNil(t, err, template)
+	}
+}
+
+// datedFile A file updated at updatedTime
+type datedFile struct {
+	FileOperator
+	updatedTime time.Time
+}
+
+func (d *datedFile) GetUpdatedTime() (*time.Time, error) {
+	return &d.updatedTime, nil
+}
+
+func (d *datedFile) Open() (io.ReadCloser, error) {
+	return Open(d.FileOperator)
+}
+
+func TestNewTemplateKey_truncatedHash(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.png"), "a")
+	// b.png has a different content whose hash starts with the same character
+	sum := sha256.Sum256([]byte("a"))
+	prefix := hex.EncodeToString(sum[:])[:1]
+	for i := 0; ; i++ {
+		content := fmt.Sprint(i)
+		sum := sha256.Sum256([]byte(content))
+		if hex.EncodeToString(sum[:])[:1] == prefix {
+			writeTestFile(t, filepath.Join(dir, "b.png"), content)
+			break
+		}
+	}
+	mdPath := filepath.Join(dir, "doc.md")
+	writeTestFile(t, mdPath, "![a](a.png) ![b](b.png)\n")
+	deps, err := NewMarkdownFile("", mdPath).FindDependencies()
+	require.Nil(t, err)
+	require.Len(t, deps, 2)
+
+	// The truncated hashes collide, so the keys are assigned distinctly
+	key, err := NewTemplateKey("{sha256:1}{ext}")
+	require.Nil(t, err)
+	require.NotEqual(t, key(deps[0], dir, "doc.md"), key(deps[1], dir, "doc.md"))
+}
@@ -0,0 +1,253 @@
+package collectable
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+var (
+	texGraphicsRegex     = regexp.MustCompile(`\\includegraphics\*?(?:\[[^\]]*\])*\{(?P<uri>[^}]+)\}`)
+	texInputRegex        = regexp.MustCompile(`\\input\{(?P<uri>[^}]+)\}`)
+	texIncludeRegex      = regexp.MustCompile(`\\include\{(?P<uri>[^}]+)\}`)
+	texBibliographyRegex = regexp.MustCompile(`\\bibliography\{(?P<uri>[^}]+)\}`)
+	texBibResourceRegex  = regexp.MustCompile(`\\addbibresource(?:\[[^\]]*\])?\{(?P<uri>[^}]+)\}`)
+	texGraphicsPathRegex = regexp.MustCompile(`\\graphicspath\{((?:\{[^}]*\})+)\}`)
+	texGroupRegex        = regexp.MustCompile(`\{([^}]*)\}`)
+)
+
+// graphicsExtensions Extensions tried by \includegraphics, in order
+var graphicsExtensions = []string{".pdf", ".png", ".jpg", ".jpeg", ".eps", ".PDF", ".PNG", ".JPG", ".JPEG", ".EPS"}
+
+func init() {
+	RegisterDocument(TeX, func(parent, uri string, options ...Option) FileOperator {
+		return NewTeXFile(parent, uri, options...)
+	}, ".tex")
+}
+
+// TeXFile Collectable files which is LaTeX source. Graphics, sub-files and
+// bibliographies referred by '\includegraphics', '\input', '\include',
+// '\bibliography' and '\addbibresource' are its dependencies.
+//
+// LaTeX resolves paths relative to the directory of the main file, so
+// sub-files find their dependencies relative to the main file and refer to the
+// collected dependencies by paths relative to the collected main file
+type TeXFile struct {
+	*textFile
+	// root is the main file of the project, nil if the file is the main file
+	root          *TeXFile
+	graphicsPaths []string
+	// objectKey is the object key the file is collected to
+	objectKey string
+}
+
+// texReference A reference found in LaTeX source
+type texReference struct {
+	reference
+	// implicitExt is true if the command appends the extension itself
+	implicitExt bool
+}
+
+// NewTeXFile Create a TeXFile object which is a collectable file for the
+// main file of a LaTeX project
+func NewTeXFile(parent, uri string, options ...Option) *TeXFile {
+	return newTeXFile(parent, uri, nil, options...)
+}
+
+func newTeXFile(parent, uri string, root *TeXFile, options ...Option) *TeXFile {
+	t := &TeXFile{
+		textFile: newTextFile(parent, uri, TeX, nil, options...),
+		root:     root,
+	}
+	for _, match := range texGraphicsPathRegex.FindAllSubmatch(t.buffer, -1) {
+		for _, group := range texGroupRegex.FindAllSubmatch(match[1], -1) {
+			t.graphicsPaths = append(t.graphicsPaths, string(group[1]))
+		}
+	}
+	return t
+}
+
+// FindDependencies Returns the files referred in the LaTeX source
+func (t *TeXFile) FindDependencies() ([]FileOperator, error) {
+	if err := t.FileError(); err != nil {
+		return nil, err
+	}
+
+	refs := t.references()
+	dependencies := make([]FileOperator, 0, len(refs))
+	found := make(map[string]struct{}, len(refs))
+	for _, ref := range refs {
+		if _, ok := found[ref.path]; ok {
+			continue
+		}
+		found[ref.path] = struct{}{}
+		dependencies = append(dependencies, t.dependency(ref.path))
+	}
+	return dependencies, nil
+}
+
+// dependency Returns the dependency located at path, sub-files share the
+// main file with the file
+func (t *TeXFile) dependency(path string) FileOperator {
+	return t.dependencies.get(path, func() FileOperator {
+		if FileTypeOf(path) == TeX {
+			return newTeXFile(t.uri, path, t.mainFile(), t.configs.dependencyOptions(t.uri)...)
+		}
+		return NewFile(t.uri, path, t.configs.dependencyOptions(t.uri)...)
+	})
+}
+
+// ReplaceDependencyURIs Replace the uris of the dependencies by the uris
+// mapped by mapper
+func (t *TeXFile) ReplaceDependencyURIs(base, objectKey string, mapper URIMapper) error {
+	return t.ReplaceDependencies(base, objectKey, mapper.DependencyMapper())
+}
+
+// ReplaceDependencies Replace the referred paths in the LaTeX source
+func (t *TeXFile) ReplaceDependencies(base, objectKey string, mapper DependencyMapper) error {
+	if err := t.FileError(); err != nil {
+		return err
+	}
+	t.objectKey = objectKey
+
+	// Paths in sub-files are relative to the directory of the main file
+	prefix := ""
+	if t.root != nil {
+		if rel, err := filepath.Rel(filepath.Dir(t.root.objectKey), filepath.Dir(objectKey)); err == nil {
+			prefix = filepath.ToSlash(rel)
+		}
+	}
+
+	refs := t.references()
+	implicitExts := make(map[int]bool, len(refs))
+	plainRefs := make([]reference, len(refs))
+	for i, ref := range refs {
+		implicitExts[ref.start] = ref.implicitExt
+		plainRefs[i] = ref.reference
+	}
+
+	t.buffer = replaceReferences(t.buffer, plainRefs, func(ref reference) []byte {
+		newURI := string(mapper(t.dependency(ref.path), base, objectKey))
+		if !schemeRegex.MatchString(newURI) && !filepath.IsAbs(newURI) {
+			newURI = path.Join(prefix, filepath.ToSlash(newURI))
+		}
+		if implicitExts[ref.start] {
+			newURI = strings.TrimSuffix(newURI, path.Ext(newURI))
+		}
+		return []byte(newURI)
+	})
+	return nil
+}
+
+func (t *TeXFile) mainFile() *TeXFile {
+	if t.root != nil {
+		return t.root
+	}
+	return t
+}
+
+// references Find all the references in the LaTeX source. The uri of the
+// references are the paths of referred files relative to the main file,
+// with the extensions completed
+func (t *TeXFile) references() []texReference {
+	main := t.mainFile()
+	graphicsPaths := main.graphicsPaths
+	if t.root != nil {
+		graphicsPaths = append(append([]string{}, graphicsPaths...), t.graphicsPaths...)
+	}
+
+	refs := make([]texReference, 0)
+	add := func(start, end int, implicitExt bool, candidates []string) {
+		if isTeXComment(t.buffer, start) {
+			return
+		}
+		resolved := ""
+		for _, candidate := range candidates {
+			p, ok := resolveLocalReference(main.uri, candidate)
+			if !ok {
+				return
+			}
+			if resolved == "" {
+				resolved = p
+			}
+			if utils.IsFileExist(p) {
+				resolved = p
+				break
+			}
+		}
+		if resolved == "" || t.configs.isAncestor(resolved) {
+			return
+		}
+		refURI := filepath.Base(resolved)
+		if rel, err := filepath.Rel(filepath.Dir(main.uri), resolved); err == nil {
+			refURI = filepath.ToSlash(rel)
+		}
+		refs = append(refs, texReference{
+			reference:   reference{start: start, end: end, uri: refURI, path: resolved},
+			implicitExt: implicitExt,
+		})
+	}
+
+	for _, match := range texGraphicsRegex.FindAllSubmatchIndex(t.buffer, -1) {
+		uri := strings.TrimSpace(string(t.buffer[match[2]:match[3]]))
+		dirs := append([]string{""}, graphicsPaths...)
+		candidates := make([]string, 0, len(dirs)*(len(graphicsExtensions)+1))
+		for _, dir := range dirs {
+			candidate := path.Join(dir, uri)
+			candidates = append(candidates, candidate)
+			if path.Ext(uri) == "" {
+				for _, ext := range graphicsExtensions {
+					candidates = append(candidates, candidate+ext)
+				}
+			}
+		}
+		add(match[2], match[3], false, candidates)
+	}
+
+	for _, match := range texInputRegex.FindAllSubmatchIndex(t.buffer, -1) {
+		uri := strings.TrimSpace(string(t.buffer[match[2]:match[3]]))
+		candidates := []string{uri + ".tex", uri}
+		if path.Ext(uri) != "" {
+			candidates = []string{uri, uri + ".tex"}
+		}
+		add(match[2], match[3], false, candidates)
+	}
+
+	for _, match := range texIncludeRegex.FindAllSubmatchIndex(t.buffer, -1) {
+		uri := strings.TrimSuffix(strings.TrimSpace(string(t.buffer[match[2]:match[3]])), ".tex")
+		add(match[2], match[3], true, []string{uri + ".tex"})
+	}
+
+	for _, match := range texBibliographyRegex.FindAllSubmatchIndex(t.buffer, -1) {
+		start := match[2]
+		for _, item := range strings.Split(string(t.buffer[match[2]:match[3]]), ",") {
+			written := strings.TrimSpace(item)
+			if written != "" {
+				uri := strings.TrimSuffix(written, ".bib")
+				itemStart := start + strings.Index(item, written)
+				add(itemStart, itemStart+len(written), true, []string{uri + ".bib"})
+			}
+			start += len(item) + 1
+		}
+	}
+
+	for _, match := range texBibResourceRegex.FindAllSubmatchIndex(t.buffer, -1) {
+		uri := strings.TrimSpace(string(t.buffer[match[2]:match[3]]))
+		add(match[2], match[3], false, []string{uri})
+	}
+
+	return refs
+}
+
+// isTeXComment Returns true if the position is commented out by '%'
+func isTeXComment(buffer []byte, pos int) bool {
+	for i := pos - 1; i >= 0 && buffer[i] != '\n'; i-- {
+		if buffer[i] == '%' && (i == 0 || buffer[i-1] != '\\') {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package collectable
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeXFile(t *testing.T) {
+	dir := t.TempDir()
+	texPath := filepath.Join(dir, "paper", "main.tex")
+	writeTestFile(t, texPath, `\documentclass{article}
+\usepackage{graphicx}
+\graphicspath{{figures/}{../shared/}}
+\begin{document}
+\includegraphics[width=\linewidth]{overview}
+% \includegraphics{unused.png}
+\input{chapters/intro}
+\include{chapters/method}
+\bibliography{refs,more.bib}
+\end{document}
+`)
+	writeTestFile(t, filepath.Join(dir, "paper", "figures", "overview.pdf"), "pdf")
+	writeTestFile(t, filepath.Join(dir, "shared", "logo.png"), "png")
+	writeTestFile(t, filepath.Join(dir, "paper", "chapters", "intro.tex"), `\includegraphics{logo}`)
+	writeTestFile(t, filepath.Join(dir, "paper", "chapters", "method.tex"), `\includegraphics{figures/overview.pdf}`)
+	writeTestFile(t, filepath.Join(dir, "paper", "refs.bib"), "@book{}")
+	writeTestFile(t, filepath.Join(dir, "paper", "more.bib"), "@book{}")
+
+	main := NewTeXFile("", texPath)
+	require.Nil(t, main.FileError())
+	require.Equal(t, TeX, main.GetFileType())
+
+	dependencies, err := main.FindDependencies()
+	require.Nil(t, err)
+	uris := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		uris = append(uris, dependency.GetURI())
+	}
+	require.ElementsMatch(t, []string{
+		filepath.Join(dir, "paper", "figures", "overview.pdf"),
+		filepath.Join(dir, "paper", "chapters", "intro.tex"),
+		filepath.Join(dir, "paper", "chapters", "method.tex"),
+		filepath.Join(dir, "paper", "refs.bib"),
+		filepath.Join(dir, "paper", "more.bib"),
+	}, uris)
+
+	require.Nil(t, main.ReplaceDependencyURIs(dir, "main.tex", LocalURIMapper))
+	require.Equal(t, `\documentclass{article}
+\usepackage{graphicx}
+\graphicspath{{figures/}{../shared/}}
+\begin{document}
+\includegraphics[width=\linewidth]{main_medias/overview.pdf}
+% \includegraphics{unused.png}
+\input{main_medias/intro.tex}
+\include{main_medias/method}
+\bibliography{main_medias/refs,main_medias/more}
+\end{document}
+`, string(main.buffer))
+
+	for _, dependency := range dependencies {
+		if dependency.GetFileType() != TeX {
+			continue
+		}
+		nested, err := dependency.FindDependencies()
+		require.Nil(t, err)
+		require.Equal(t, 1, len(nested))
+
+		require.Nil(t, dependency.ReplaceDependencyURIs(dir, "main_medias/"+filepath.Base(dependency.GetURI()), LocalURIMapper))
+		switch filepath.Base(dependency.GetURI()) {
+		case "intro.tex":
+			require.Equal(t, filepath.Join(dir, "shared", "logo.png"), nested[0].GetURI())
+			require.Equal(t, `\includegraphics{main_medias/intro_medias/logo.png}`, string(dependency.(*TeXFile).buffer))
+		case "method.tex":
+			require.Equal(t, filepath.Join(dir, "paper", "figures", "overview.pdf"), nested[0].GetURI())
+			require.Equal(t, `\includegraphics{main_medias/method_medias/overview.pdf}`, string(dependency.(*TeXFile).buffer))
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package collectable
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slipfre/imgmd/provider"
+	"github.com/slipfre/imgmd/utils"
+)
+
+var schemeRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.\-]*:`)
+
+// reference A reference to another file which is found in a text file
+type reference struct {
+	// start and end are the offsets of the referenced uri in the buffer
+	start int
+	end   int
+	// uri is the referenced uri as it is written in the file
+	uri string
+	// path is the location of the referenced file
+	path string
+}
+
+// referenceFinder Find all the references in the buffer of the file located at uri
+type referenceFinder func(buffer []byte, uri string) []reference
+
+// dependencyCache Dependencies found in a file, keyed by their locations. It
+// makes ReplaceDependencies map the same dependencies FindDependencies
+// returned
+type dependencyCache map[string]FileOperator
+
+// get Returns the dependency located at path, it is created if not cached
+func (c dependencyCache) get(path string, create func() FileOperator) FileOperator {
+	if dep, ok := c[path]; ok {
+		return dep
+	}
+	dep := create()
+	c[path] = dep
+	return dep
+}
+
+// textFile Collectable file which refers to its dependencies in its text
+type textFile struct {
+	*FileAttrs
+	buffer       []byte
+	find         referenceFinder
+	configs      *Configs
+	dependencies dependencyCache
+	// format adjusts the new uri before it is written to the text, it is
+	// optional
+	format func(buffer []byte, ref reference, newURI []byte) []byte
+}
+
+func newTextFile(parent, uri string, fileType FileType, find referenceFinder, options ...Option) *textFile {
+	uri, data, updatedTime, fError := readFile(uri)
+	return &textFile{
+		FileAttrs:    NewFileAttrs(parent, uri, fileType, updatedTime, fError),
+		buffer:       data,
+		find:         find,
+		configs:      newConfigs(options...),
+		dependencies: make(dependencyCache),
+	}
+}
+
+// readFile Read the content of the file located at uri. Returns the absolute
+// uri for local file and its last updated time
+func readFile(uri string) (string, []byte, *time.Time, error) {
+	reader, fError := utils.NewFileReader(uri)
+	if fError == nil {
+		defer reader.Close()
+	}
+
+	var data []byte
+	if fError == nil {
+		data, fError = ioutil.ReadAll(reader)
+	}
+
+	var updatedTimePtr *time.Time
+	if !utils.IsHTTPURI(uri) {
+		var fi os.FileInfo
+		if fError == nil {
+			if fi, fError = os.Stat(uri); fError == nil {
+				updatedTime := fi.ModTime()
+				updatedTimePtr = &updatedTime
+			}
+		}
+
+		if absURI, err := filepath.Abs(uri); err == nil {
+			uri = absURI
+		}
+	}
+
+	return uri, data, updatedTimePtr, fError
+}
+
+// FindDependencies Returns the files referred in the text
+func (t *textFile) FindDependencies() ([]FileOperator, error) {
+	if err := t.FileError(); err != nil {
+		return nil, err
+	}
+
+	refs := t.references()
+	dependencies := make([]FileOperator, 0, len(refs))
+	found := make(map[string]struct{}, len(refs))
+	for _, ref := range refs {
+		if _, ok := found[ref.path]; ok {
+			continue
+		}
+		found[ref.path] = struct{}{}
+		dependencies = append(dependencies, t.dependency(ref.path))
+	}
+	return dependencies, nil
+}
+
+// references Returns the references found in the text, the ones to remote
+// files are left out unless they are mirrored, and the ones back to the files
+// referring to the file are left out
+func (t *textFile) references() []reference {
+	refs := t.find(t.buffer, t.uri)
+	kept := make([]reference, 0, len(refs))
+	for _, ref := range refs {
+		if utils.IsHTTPURI(ref.path) && !t.configs.mirrorRemote() {
+			continue
+		}
+		if t.configs.isAncestor(ref.path) {
+			continue
+		}
+		kept = append(kept, ref)
+	}
+	return kept
+}
+
+// dependency Returns the dependency located at path
+func (t *textFile) dependency(path string) FileOperator {
+	return t.dependencies.get(path, func() FileOperator {
+		return NewFile(t.uri, path, t.configs.dependencyOptions(t.uri)...)
+	})
+}
+
+// ReplaceDependencyURIs Replace the uris of the dependencies by the uris
+// mapped by mapper
+func (t *textFile) ReplaceDependencyURIs(base, objectKey string, mapper URIMapper) error {
+	return t.ReplaceDependencies(base, objectKey, mapper.DependencyMapper())
+}
+
+// ReplaceDependencies Replace the referred uris in the text
+func (t *textFile) ReplaceDependencies(base, objectKey string, mapper DependencyMapper) error {
+	if err := t.FileError(); err != nil {
+		return err
+	}
+
+	t.buffer = replaceReferences(t.buffer, t.references(), func(ref reference) []byte {
+		newURI := mapper(t.dependency(ref.path), base, objectKey)
+		if isEscaped(ref.uri) {
+			newURI = escapeLocalURI(newURI)
+		}
+		if t.format != nil {
+			newURI = t.format(t.buffer, ref, newURI)
+		}
+		return newURI
+	})
+	return nil
+}
+
+// Open Returns a reader of the buffer
+func (t *textFile) Open() (io.ReadCloser, error) {
+	if err := t.FileError(); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(t.buffer)), nil
+}
+
+// To Write the buffer to file
+func (t *textFile) To(uri string) error {
+	if err := t.FileError(); err != nil {
+		return err
+	}
+	if err := utils.CreateDirectory(filepath.Dir(uri)); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(uri, t.buffer, 0666)
+}
+
+// ToOBS Write the file to bucket
+func (t *textFile) ToOBS(bucket provider.Bucket, key string) error {
+	if err := t.FileError(); err != nil {
+		return err
+	}
+	if bucket == nil {
+		return errors.New("bucket should not be nil")
+	}
+	_, err := bucket.PutObjectFromBytes(filepath.ToSlash(key), t.buffer)
+	return err
+}
+
+// replaceReferences Returns a copy of buffer in which every reference is
+// replaced by the result of replace
+func replaceReferences(buffer []byte, refs []reference, replace func(ref reference) []byte) []byte {
+	sort.Slice(refs, func(i, j int) bool { return refs[i].start < refs[j].start })
+
+	result := make([]byte, 0, len(buffer))
+	last := 0
+	for _, ref := range refs {
+		if ref.start < last {
+			// Overlapped with the previous reference
+			continue
+		}
+		result = append(result, buffer[last:ref.start]...)
+		result = append(result, replace(ref)...)
+		last = ref.end
+	}
+	return append(result, buffer[last:]...)
+}
+
+// resolveLocalReference Resolve the uri referred in the file located at
+// parentURI to a local path. Returns false if the uri does not refer to a
+// local file, e.g. an url or an anchor
+func resolveLocalReference(parentURI, uri string) (string, bool) {
+	if uri == "" || strings.HasPrefix(uri, "#") || strings.HasPrefix(uri, "//") {
+		return "", false
+	}
+	if schemeRegex.MatchString(uri) && filepath.VolumeName(uri) == "" {
+		return "", false
+	}
+	if unescaped, err := url.PathUnescape(uri); err == nil {
+		uri = unescaped
+	}
+	if !filepath.IsAbs(uri) {
+		uri = filepath.Join(filepath.Dir(parentURI), uri)
+	}
+	if uri == parentURI {
+		return "", false
+	}
+	return uri, true
+}
+
+// isEscaped Returns true if the uri is written with percent-encoding
+func isEscaped(uri string) bool {
+	unescaped, err := url.PathUnescape(uri)
+	return err == nil && unescaped != uri
+}
+
+// escapeLocalURI Percent-encode the uri unless it has a scheme, so that it is
+// written in the same way as the uri it replaces
+func escapeLocalURI(uri []byte) []byte {
+	if schemeRegex.Match(uri) {
+		return uri
+	}
+	escaped := &url.URL{Path: filepath.ToSlash(string(uri))}
+	return []byte(escaped.EscapedPath())
+}
+
+// trimQueryAndFragment Returns uri without '?query' and '#fragment'
+func trimQueryAndFragment(uri string) string {
+	if i := strings.IndexAny(uri, "?#"); i >= 0 {
+		return uri[:i]
+	}
+	return uri
+}
+
+// regexReferenceFinder Returns a referenceFinder which finds the references
+// to local files matched by the groups named 'uri' of the patterns
+func regexReferenceFinder(patterns ...*regexp.Regexp) referenceFinder {
+	return regexFinder(false, patterns...)
+}
+
+// regexResourceFinder Returns a referenceFinder like regexReferenceFinder,
+// which finds the references to remote files by http or https urls as well
+func regexResourceFinder(patterns ...*regexp.Regexp) referenceFinder {
+	return regexFinder(true, patterns...)
+}
+
+func regexFinder(remote bool, patterns ...*regexp.Regexp) referenceFinder {
+	return func(buffer []byte, uri string) []reference {
+		refs := make([]reference, 0)
+		for _, pattern := range patterns {
+			names := pattern.SubexpNames()
+			for _, match := range pattern.FindAllSubmatchIndex(buffer, -1) {
+				for i, name := range names {
+					if name != "uri" || match[2*i] < 0 {
+						continue
+					}
+					start, end := match[2*i], match[2*i+1]
+					if written := string(buffer[start:end]); remote && utils.IsHTTPURI(written) {
+						refs = append(refs, reference{start: start, end: end, uri: written, path: written})
+						continue
+					}
+					refURI := trimQueryAndFragment(string(buffer[start:end]))
+					path, ok := resolveLocalReference(uri, refURI)
+					if !ok {
+						continue
+					}
+					refs = append(refs, reference{
+						start: start,
+						end:   start + len(refURI),
+						uri:   refURI,
+						path:  path,
+					})
+				}
+			}
+		}
+		return refs
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/slipfre/imgmd/utils"
 )
 
-// LocalURIMapper Map the uri to 'targetDirPath/filename'
+// LocalURIMapper Map the uri to 'targetDirPath/filename'. Dependencies sharing
+// a file name are mapped to the same uri, collectors refer to dependencies by
+// the mappers of a MapperFactory instead
 func LocalURIMapper(fileType FileType, uri []byte, base, objectKey string) []byte {
 	destDirPath := utils.GetTargetResourcesDirPath(filepath.Join(base, objectKey))
 	dirName := filepath.Base(destDirPath)
@@ -18,7 +20,7 @@ func LocalURIMapper(fileType FileType, uri []byte, base, objectKey string) []byt
 }
 
 // GetOBSURIMapper Returns a OBSURIMapper which maps the uri to corresponding
-// object under the bucket
+// object under the bucket, by the file name as LocalURIMapper does
 func GetOBSURIMapper(bucket provider.Bucket) (URIMapper, error) {
 	if bucket == nil {
 		return nil, errors.New("bucket should not be nil")
@@ -29,3 +31,46 @@ func GetOBSURIMapper(bucket provider.Bucket) (URIMapper, error) {
 		return []byte(bucket.GetObjectURL(filepath.ToSlash(depObjKey)))
 	}, nil
 }
+
+// MapperFactory Returns the DependencyMapper which refers to the dependencies
+// collected to the keys returned by key
+type MapperFactory func(key KeyFunc) (DependencyMapper, error)
+
+// LocalMapperFactory MapperFactory of the mappers returned by
+// NewLocalDependencyMapper
+func LocalMapperFactory(key KeyFunc) (DependencyMapper, error) {
+	return NewLocalDependencyMapper(key), nil
+}
+
+// GetOBSMapperFactory Returns a MapperFactory of the mappers returned by
+// NewOBSDependencyMapper for the bucket
+func GetOBSMapperFactory(bucket provider.Bucket) MapperFactory {
+	return func(key KeyFunc) (DependencyMapper, error) {
+		return NewOBSDependencyMapper(bucket, key)
+	}
+}
+
+// NewLocalDependencyMapper Returns a DependencyMapper which maps the dependency
+// to the path of it collected to the key returned by key, relative to the file
+// referring to it
+func NewLocalDependencyMapper(key KeyFunc) DependencyMapper {
+	return func(dep FileOperator, base, objectKey string) []byte {
+		depObjKey := key(dep, base, objectKey)
+		newReferencePath, err := filepath.Rel(filepath.Dir(objectKey), depObjKey)
+		if err != nil {
+			newReferencePath = depObjKey
+		}
+		return []byte(newReferencePath)
+	}
+}
+
+// NewOBSDependencyMapper Returns a DependencyMapper which maps the dependency to
+// the object under the bucket with the key returned by key
+func NewOBSDependencyMapper(bucket provider.Bucket, key KeyFunc) (DependencyMapper, error) {
+	if bucket == nil {
+		return nil, errors.New("bucket should not be nil")
+	}
+	return func(dep FileOperator, base, objectKey string) []byte {
+		return []byte(bucket.GetObjectURL(filepath.ToSlash(key(dep, base, objectKey))))
+	}, nil
+}
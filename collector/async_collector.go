@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"path/filepath"
-	"reflect"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/slipfre/imgmd/collectable"
+	"github.com/slipfre/imgmd/manifest"
 	"github.com/slipfre/imgmd/utils"
 )
 
@@ -18,20 +21,70 @@ type AsyncCollector struct {
 	targetPath            string
 	force                 bool
 	depCollectorGenerator Generator
-	depURIMapper          collectable.URIMapper
+	depMapper             collectable.DependencyMapper
 	freshValidator        FreshValidator
 	mover                 Mover
+	scheduler             *Scheduler
+	keyFunc               collectable.KeyFunc
+	manifest              *manifest.Manifest
+	remoteIO              bool
+	locator               Locator
+	dependency            bool
+	journal               *Journal
+	transaction           *Transaction
+	snapshot              Snapshot
+	keepGoing             bool
+	observer              Observer
+	document              string
 }
 
 func defaultCollectorConfigs() *Configs {
 	configs := &Configs{
-		Force: false,
+		Force:    false,
+		Locator:  LocalLocator,
+		Snapshot: LocalSnapshot,
 	}
 	return configs
 }
 
-// NewAsyncCollector Constructor for NewAsyncCollector
-func NewAsyncCollector(cf collectable.FileOperator, base, objectKey string, freshValidator FreshValidator, mover Mover, depURIMapper collectable.URIMapper, depCollectorGenerator Generator, options ...Option) (*AsyncCollector, error) {
+func applyOptions(options ...Option) *Configs {
+	configs := defaultCollectorConfigs()
+	for _, option := range options {
+		option(configs)
+	}
+	if configs.KeyFunc == nil {
+		configs.KeyFunc = collectable.NewKeyAssigner(collectable.DependencyKey).Key
+	}
+	return configs
+}
+
+// withKeyFunc Returns the configs of the options, and the options with the key
+// func of the configs, so that the KeyAssigner created when no key func is
+// given is shared by the collector and the mapper of its dependencies
+func withKeyFunc(options []Option) (*Configs, []Option) {
+	configs := applyOptions(options...)
+	withKey := make([]Option, 0, len(options)+1)
+	withKey = append(withKey, options...)
+	return configs, append(withKey, WithKeyFunc(configs.KeyFunc))
+}
+
+// NewAsyncCollector Constructor for NewAsyncCollector, which refers to the
+// dependencies by the mapper created by newDepMapper with its key func
+func NewAsyncCollector(cf collectable.FileOperator, base, objectKey string, freshValidator FreshValidator, mover Mover, newDepMapper collectable.MapperFactory, depCollectorGenerator Generator, options ...Option) (*AsyncCollector, error) {
+	if newDepMapper == nil {
+		return nil, errors.New("'MapperFactory' should not be nil")
+	}
+	configs, options := withKeyFunc(options)
+	depMapper, err := newDepMapper(configs.KeyFunc)
+	if err != nil {
+		return nil, err
+	}
+	return newAsyncCollector(cf, base, objectKey, freshValidator, mover, depMapper, depCollectorGenerator, options...)
+}
+
+// newAsyncCollector Constructor for NewAsyncCollector which maps the
+// dependencies by depMapper
+func newAsyncCollector(cf collectable.FileOperator, base, objectKey string, freshValidator FreshValidator, mover Mover, depMapper collectable.DependencyMapper, depCollectorGenerator Generator, options ...Option) (*AsyncCollector, error) {
 	if freshValidator == nil {
 		return nil, errors.New("'FreshValidator' should not be nil")
 	}
@@ -44,10 +97,10 @@ func NewAsyncCollector(cf collectable.FileOperator, base, objectKey string, fres
 		return nil, errors.New("'Generator' should not be nil")
 	}
 
-	configs := defaultCollectorConfigs()
-
-	for _, option := range options {
-		option(configs)
+	configs := applyOptions(options...)
+	document := configs.Document
+	if !configs.Dependency {
+		document = cf.GetURI()
 	}
 
 	return &AsyncCollector{
@@ -56,96 +109,327 @@ func NewAsyncCollector(cf collectable.FileOperator, base, objectKey string, fres
 		objectKey:             objectKey,
 		targetPath:            filepath.Join(base, objectKey),
 		freshValidator:        freshValidator,
-		depURIMapper:          depURIMapper,
+		depMapper:             depMapper,
 		mover:                 mover,
 		depCollectorGenerator: depCollectorGenerator,
 		force:                 configs.Force,
+		scheduler:             configs.Scheduler,
+		keyFunc:               configs.KeyFunc,
+		manifest:              configs.Manifest,
+		remoteIO:              configs.RemoteIO,
+		locator:               configs.Locator,
+		dependency:            configs.Dependency,
+		journal:               configs.Journal,
+		transaction:           configs.Transaction,
+		snapshot:              configs.Snapshot,
+		keepGoing:             configs.KeepGoing,
+		observer:              configs.Observer,
+		document:              document,
 	}, nil
 }
 
 // Collect Collect the collectableFile
 func (c *AsyncCollector) Collect(ctx context.Context) <-chan error {
-	complete := make(chan error)
-	go c.collectFileAsync(ctx, complete)
+	complete := make(chan error, 1)
+	if c.dependency {
+		go c.collectFileAsync(ctx, c.transaction, complete)
+		return complete
+	}
+	go func() {
+		c.emit(Event{Type: EventDocumentStarted})
+		var tx *Transaction
+		if c.journal != nil {
+			tx = c.journal.Begin()
+		}
+		collected := make(chan error, 1)
+		c.collectFileAsync(ctx, tx, collected)
+		errs := FileErrors(<-collected)
+		if tx != nil {
+			if len(errs) == 0 {
+				tx.Commit()
+			} else if err := tx.Rollback(); err != nil {
+				errs = append(errs, c.fail(StageRollback, err))
+			}
+		}
+		err := c.attribute(errs)
+		c.emit(Event{Type: EventFinished, Err: err})
+		complete <- err
+	}()
 	return complete
 }
 
-func (c *AsyncCollector) collectFileAsync(ctx context.Context, complete chan<- error) {
+func (c *AsyncCollector) collectFileAsync(ctx context.Context, tx *Transaction, complete chan<- error) {
 	cancelCF, err := collectable.WithCancel(ctx, c.collectableFile)
 	if err != nil {
-		complete <- err
+		complete <- c.fail(StageRead, err)
 		return
 	}
 
-	if !c.force {
-		needCollect, err := c.freshValidator(c.collectableFile, c.base, c.objectKey)
-		if err != nil {
-			complete <- err
-			return
-		}
-		if !needCollect {
-			complete <- nil
-			return
-		}
-	}
-
-	deps, err := cancelCF.FindDependencies()
+	var deps []collectable.FileOperator
+	err = c.schedule(ctx, false, func() (err error) {
+		deps, err = cancelCF.FindDependencies()
+		return
+	})
 	if err != nil {
-		complete <- err
+		complete <- c.fail(StageRead, err)
 		return
 	}
 
+	depTargets := make([]string, 0, len(deps))
+	var depObjKeys map[collectable.FileOperator]string
 	if deps != nil && len(deps) > 0 {
-		depObjDir := utils.GetTargetResourcesDirPath(c.objectKey)
+		c.fetch(ctx, deps)
+		// Keys may be derived from the contents, which are read on the local
+		// slots
+		err = c.schedule(ctx, false, func() error {
+			depObjKeys = c.keys(deps)
+			return collectable.ReplaceDependencies(cancelCF, c.base, c.objectKey, c.depMapper)
+		})
+		if err != nil {
+			complete <- c.fail(StageRead, err)
+			return
+		}
+	}
 
-		err = cancelCF.ReplaceDependencyURIs(c.base, c.objectKey, c.depURIMapper)
+	// The freshness is validated by the digest of the content with the
+	// dependency uris replaced, before the dependencies are collected. They
+	// are collected even if the file is fresh, since they may have changed
+	// on their own, and are validated by their own collectors
+	fresh := false
+	if !c.force {
+		var needCollect bool
+		err := c.schedule(ctx, c.remoteIO, func() (err error) {
+			needCollect, err = c.freshValidator(cancelCF, c.base, c.objectKey)
+			return
+		})
 		if err != nil {
-			complete <- err
+			complete <- c.fail(StageFreshCheck, err)
 			return
 		}
+		fresh = !needCollect
+	}
 
+	if deps != nil && len(deps) > 0 {
 		subCtx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
-		cases := make([]reflect.SelectCase, len(deps))
-		for i, dep := range deps {
-			depObjKey := filepath.Join(depObjDir, filepath.Base(dep.GetURI()))
+		// Once a dependency fails, the others are cancelled unless keepGoing,
+		// and waited for, so that nothing is collected after the failure is
+		// reported
+		depErrs := make([]*FileError, 0)
+		completes := make([]<-chan error, 0, len(deps))
+		for _, dep := range deps {
+			depObjKey := depObjKeys[dep]
+			depTarget := filepath.Join(c.base, depObjKey)
+			depTargets = append(depTargets, depTarget)
+			c.emit(Event{Type: EventDependencyDiscovered, File: dep.GetURI(), Target: depTarget})
+			if tx != nil {
+				tx.Use(depTarget)
+			}
 			collector, err := c.depCollectorGenerator(
 				dep, c.base, depObjKey,
 				c.depCollectorGenerator,
 				WithForce(c.force),
+				WithScheduler(c.scheduler),
+				WithKeyFunc(c.keyFunc),
+				WithManifest(c.manifest),
+				WithKeepGoing(c.keepGoing),
+				WithObserver(c.observer),
+				withDocument(c.document),
+				withTransaction(tx),
+				asDependency(),
 			)
 			if err != nil {
-				cancel()
-				complete <- err
-				return
-			}
-			subComplete := collector.Collect(subCtx)
-			cases[i] = reflect.SelectCase{
-				Dir:  reflect.SelectRecv,
-				Chan: reflect.ValueOf(subComplete),
+				depErrs = append(depErrs, &FileError{Dependency: dep.GetURI(), Target: depTarget, Err: err})
+				if !c.keepGoing {
+					cancel()
+					break
+				}
+				continue
 			}
+			completes = append(completes, collector.Collect(subCtx))
 		}
 
-		for remaining := len(deps); remaining > 0; remaining-- {
-			chosen, value, _ := reflect.Select(cases)
-			if value.Interface() != nil {
-				err = value.Interface().(error)
+		for err := range Merge(completes...) {
+			if err == nil || (len(depErrs) > 0 && !c.keepGoing) {
+				continue
 			}
-			if err != nil {
+			depErrs = append(depErrs, FileErrors(err)...)
+			if !c.keepGoing {
 				cancel()
-				complete <- err.(error)
-				return
 			}
-			cases[chosen].Chan = reflect.ValueOf(nil)
-			continue
+		}
+		if len(depErrs) > 0 {
+			complete <- &MultiError{Errors: depErrs}
+			return
 		}
 	}
 
-	if err = c.mover(cancelCF, c.base, c.objectKey); err != nil {
-		complete <- err
+	if fresh {
+		if err := c.record(cancelCF, depTargets, true); err != nil {
+			complete <- c.fail(StageWrite, err)
+			return
+		}
+		c.emit(Event{Type: EventSkippedFresh, Location: c.locator(c.base, c.objectKey)})
+		complete <- nil
 		return
 	}
 
+	err = c.schedule(ctx, c.remoteIO, func() error {
+		return c.move(cancelCF, tx)
+	})
+	if err != nil {
+		stage := StageWrite
+		if c.remoteIO {
+			stage = StageUpload
+		}
+		complete <- c.fail(stage, err)
+		return
+	}
+
+	if err := c.record(cancelCF, depTargets, false); err != nil {
+		complete <- c.fail(StageWrite, err)
+		return
+	}
+	if c.remoteIO {
+		c.emit(Event{Type: EventUploaded, Location: c.locator(c.base, c.objectKey)})
+	} else {
+		c.emit(Event{Type: EventRewritten, Location: c.locator(c.base, c.objectKey)})
+	}
 	complete <- nil
 }
+
+// keys Returns the object keys of the dependencies. The keys are asked for in
+// the order of the sources, so that the dependencies sharing a key are told
+// apart in the same way whichever collector comes first
+func (c *AsyncCollector) keys(deps []collectable.FileOperator) map[collectable.FileOperator]string {
+	sorted := make([]collectable.FileOperator, len(deps))
+	copy(sorted, deps)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetURI() < sorted[j].GetURI()
+	})
+	keys := make(map[collectable.FileOperator]string, len(deps))
+	for _, dep := range sorted {
+		keys[dep] = c.keyFunc(dep, c.base, c.objectKey)
+	}
+	return keys
+}
+
+// fetch Download the remote dependencies on the remote slots, since they are
+// read to be mapped. The errors are kept by the dependencies, and reported by
+// their collectors
+func (c *AsyncCollector) fetch(ctx context.Context, deps []collectable.FileOperator) {
+	wg := sync.WaitGroup{}
+	for _, dep := range deps {
+		fetcher, ok := dep.(collectable.Fetcher)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.schedule(ctx, true, func() error {
+				return fetcher.Fetch(ctx)
+			})
+		}()
+	}
+	wg.Wait()
+}
+
+// fail Returns the error of collecting the file at the stage
+func (c *AsyncCollector) fail(stage Stage, err error) *FileError {
+	fileError := &FileError{Target: c.targetPath, Stage: stage, Err: err}
+	if c.dependency {
+		fileError.Dependency = c.collectableFile.GetURI()
+	}
+	c.emit(Event{Type: EventFailed, Err: fileError})
+	return fileError
+}
+
+// emit Report the event to the observer, the file of the event is the one of
+// the collector unless specified
+func (c *AsyncCollector) emit(event Event) {
+	if c.observer == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.Document = c.document
+	if event.File == "" {
+		event.File = c.collectableFile.GetURI()
+		event.Target = c.targetPath
+	}
+	c.observer(event)
+}
+
+// attribute Returns the errors attributed to the document, nil if there are
+// none. The errors are copied, since the ones of shared dependencies are
+// reported to every document referring to them
+func (c *AsyncCollector) attribute(errs []*FileError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	attributed := make([]*FileError, len(errs))
+	for i, err := range errs {
+		copied := *err
+		copied.Document = c.collectableFile.GetURI()
+		if copied.Target == "" {
+			copied.Target = c.targetPath
+		}
+		attributed[i] = &copied
+	}
+	return &MultiError{Errors: attributed}
+}
+
+// move Move the file, and journal it in the transaction if any, so that it is
+// undone if the transaction is rolled back
+func (c *AsyncCollector) move(cf collectable.FileOperator, tx *Transaction) error {
+	if tx == nil {
+		return c.mover(cf, c.base, c.objectKey)
+	}
+	undo, done, err := c.snapshot(c.base, c.objectKey)
+	if err != nil {
+		return err
+	}
+	err = c.mover(cf, c.base, c.objectKey)
+	if journalErr := tx.Created(c.targetPath, undo, done); err == nil {
+		err = journalErr
+	}
+	return err
+}
+
+// record Record the collected file in the manifest, and commit the record if
+// the file is a document
+func (c *AsyncCollector) record(cf collectable.FileOperator, depTargets []string, fresh bool) error {
+	if c.manifest == nil {
+		return nil
+	}
+	digest, err := digestOf(cf)
+	if err != nil {
+		return err
+	}
+	source := cf.GetURI()
+	if abs, err := filepath.Abs(source); err == nil && !utils.IsHTTPURI(source) {
+		source = abs
+	}
+	c.manifest.Record(c.targetPath, manifest.Object{
+		Source:       source,
+		SHA256:       digest.SHA256,
+		Location:     c.locator(c.base, c.objectKey),
+		Dependencies: depTargets,
+		Fresh:        fresh,
+	})
+	if c.dependency {
+		return nil
+	}
+	return c.manifest.Commit(c.targetPath)
+}
+
+// schedule Run the job when the scheduler allows, as remote I/O if remote is
+// true. Dependencies are collected out of the job, so that collectors waiting
+// for their dependencies do not hold the slots
+func (c *AsyncCollector) schedule(ctx context.Context, remote bool, job func() error) error {
+	if remote {
+		return c.scheduler.Remote(ctx, job)
+	}
+	return c.scheduler.Local(ctx, job)
+}
@@ -2,8 +2,11 @@ package collector
 
 import (
 	"context"
+	"path/filepath"
 
 	"github.com/slipfre/imgmd/collectable"
+	"github.com/slipfre/imgmd/manifest"
+	"github.com/slipfre/imgmd/provider"
 )
 
 // Collector Collect collecatable files
@@ -24,6 +27,53 @@ type Generator func(cf collectable.FileOperator, base, objectKey string, depGene
 type Configs struct {
 	Force                 bool
 	DepCollectorGenerator Generator
+	Scheduler             *Scheduler
+	// KeyFunc Returns the object keys of the dependencies
+	KeyFunc collectable.KeyFunc
+	// Manifest Records the collected files, nil for not recording
+	Manifest *manifest.Manifest
+	// RemoteIO is true if the collector validates and moves files remotely
+	RemoteIO bool
+	// Locator Returns where the file collected to base/objectKey is stored
+	Locator Locator
+	// Dependency is true if the collector collects a dependency rather than a
+	// document
+	Dependency bool
+	// Journal Journals the files created for each document, so that they are
+	// undone if the document fails, nil for not journaling
+	Journal *Journal
+	// Transaction The transaction of the document the dependency is collected
+	// for
+	Transaction *Transaction
+	// Snapshot Prepares for undoing the collection of the file
+	Snapshot Snapshot
+	// KeepGoing is true if the dependencies are all attempted even though some
+	// of them fail
+	KeepGoing bool
+	// Observer Observes the events of the collector, nil for not observing
+	Observer Observer
+	// Document The source uri of the document the dependency is collected for
+	Document string
+}
+
+// Locator Returns where the file collected to base/objectKey is stored
+type Locator func(base, objectKey string) manifest.Location
+
+// LocalLocator Locator of the files collected to local
+func LocalLocator(base, objectKey string) manifest.Location {
+	path := filepath.Join(base, objectKey)
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return manifest.Location{Path: path}
+}
+
+// GetOBSLocator Returns a Locator of the files collected to the bucket
+func GetOBSLocator(bucket provider.Bucket) Locator {
+	return func(base, objectKey string) manifest.Location {
+		key := filepath.ToSlash(objectKey)
+		return manifest.Location{Bucket: bucket.GetName(), Key: key, URL: bucket.GetObjectURL(key)}
+	}
 }
 
 // Option Options for collectors
@@ -36,3 +86,112 @@ func WithForce(force bool) Option {
 		configs.Force = force
 	}
 }
+
+// WithScheduler Option config for collectors. The collector and the collectors
+// of its dependencies do I/O when the scheduler allows
+func WithScheduler(scheduler *Scheduler) Option {
+	return func(configs *Configs) {
+		configs.Scheduler = scheduler
+	}
+}
+
+// WithKeyFunc Option config for collectors. The collector and the collectors of
+// its dependencies collect the dependencies to the keys returned by keyFunc
+func WithKeyFunc(keyFunc collectable.KeyFunc) Option {
+	return func(configs *Configs) {
+		configs.KeyFunc = keyFunc
+	}
+}
+
+// WithManifest Option config for collectors. The collector and the collectors
+// of its dependencies record the collected files in the manifest, and the
+// collector of a document commits the record of the document once it is done
+func WithManifest(m *manifest.Manifest) Option {
+	return func(configs *Configs) {
+		configs.Manifest = m
+	}
+}
+
+// WithJournal Option config for collectors. The collector of a document
+// journals the files created for the document and its dependencies, and undoes
+// them if any of them fails, so that the document is collected all or nothing
+func WithJournal(journal *Journal) Option {
+	return func(configs *Configs) {
+		configs.Journal = journal
+	}
+}
+
+// WithKeepGoing Option config for collectors. If keepGoing is true, the
+// collector and the collectors of its dependencies attempt all the dependencies
+// even though some of them fail, and report all the errors in a MultiError.
+// The file referring to a failed dependency is not collected
+func WithKeepGoing(keepGoing bool) Option {
+	return func(configs *Configs) {
+		configs.KeepGoing = keepGoing
+	}
+}
+
+// WithObserver Option config for collectors. The collector and the collectors
+// of its dependencies report their events to observer, and to the observers
+// of the former WithObserver options
+func WithObserver(observer Observer) Option {
+	return func(configs *Configs) {
+		if previous := configs.Observer; previous != nil && observer != nil {
+			configs.Observer = func(event Event) {
+				previous(event)
+				observer(event)
+			}
+			return
+		}
+		if observer != nil {
+			configs.Observer = observer
+		}
+	}
+}
+
+// withDocument Option config for the collectors of dependencies, which are
+// collected for the document
+func withDocument(document string) Option {
+	return func(configs *Configs) {
+		configs.Document = document
+	}
+}
+
+// withTransaction Option config for the collectors of dependencies, which
+// journal the created files in the transaction of the document
+func withTransaction(tx *Transaction) Option {
+	return func(configs *Configs) {
+		configs.Transaction = tx
+	}
+}
+
+// withSnapshot Option config for collectors which prepare for undoing by
+// snapshot
+func withSnapshot(snapshot Snapshot) Option {
+	return func(configs *Configs) {
+		configs.Snapshot = snapshot
+	}
+}
+
+// withRemoteIO Option config for collectors which validate and move files
+// remotely
+func withRemoteIO() Option {
+	return func(configs *Configs) {
+		configs.RemoteIO = true
+	}
+}
+
+// withLocator Option config for collectors which store files where locator
+// returns
+func withLocator(locator Locator) Option {
+	return func(configs *Configs) {
+		configs.Locator = locator
+	}
+}
+
+// asDependency Option config for the collectors of dependencies
+func asDependency() Option {
+	return func(configs *Configs) {
+		configs.Dependency = true
+	}
+}
@@ -1,14 +1,20 @@
 package collector
 
 import (
+	"context"
+	"path/filepath"
+	"time"
+
 	"github.com/slipfre/imgmd/collectable"
 	"github.com/slipfre/imgmd/provider"
 )
 
 // LocalCollectorGenerator Generate local collectors
 func LocalCollectorGenerator(cf collectable.FileOperator, base, objectKey string, depGenerator Generator, options ...Option) (Collector, error) {
-	collector, err := NewAsyncCollector(
-		cf, base, objectKey, LocalFileFreshValidator, LocalMover, collectable.LocalURIMapper, depGenerator, options...)
+	configs, options := withKeyFunc(options)
+	mapper := collectable.NewLocalDependencyMapper(configs.KeyFunc)
+	collector, err := newAsyncCollector(
+		cf, base, objectKey, LocalFileFreshValidator, LocalMover, mapper, depGenerator, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -22,16 +28,36 @@ func GetOBSCollectorGenerator(bucket provider.Bucket) Generator {
 		if err != nil {
 			return nil, err
 		}
-		mover, err := GetOBSMover(bucket)
+		configs, options := withKeyFunc(options)
+		moverBucket := bucket
+		if observer := configs.Observer; observer != nil {
+			document := configs.Document
+			if !configs.Dependency {
+				document = cf.GetURI()
+			}
+			target := filepath.Join(base, objectKey)
+			moverBucket = provider.NewProgressBucket(bucket, func(objectKey string, transferred, total int64) {
+				observer(Event{
+					Type:        EventUploadProgress,
+					Time:        time.Now(),
+					Document:    document,
+					File:        cf.GetURI(),
+					Target:      target,
+					Transferred: transferred,
+					Total:       total,
+				})
+			})
+		}
+		mover, err := GetOBSMover(moverBucket)
 		if err != nil {
 			return nil, err
 		}
-		mapper, err := collectable.GetOBSURIMapper(bucket)
+		mapper, err := collectable.NewOBSDependencyMapper(bucket, configs.KeyFunc)
 		if err != nil {
 			return nil, err
 		}
-		collector, err := NewAsyncCollector(
-			cf, base, objectKey, validator, mover, mapper, generator, options...)
+		collector, err := newAsyncCollector(
+			cf, base, objectKey, validator, mover, mapper, generator, append(options, withRemoteIO(), withLocator(GetOBSLocator(bucket)), withSnapshot(GetOBSSnapshot(bucket)))...)
 		if err != nil {
 			return nil, err
 		}
@@ -54,14 +80,56 @@ func GetPartOBSCollectorGenerator(bucket provider.Bucket, types map[collectable.
 }
 
 // GetLocalCollectorGenerator Returns a collector generator which collect to
-// local and collect dependencies to obs
-func GetLocalCollectorGenerator(urimapper collectable.URIMapper) Generator {
+// local and refer to the dependencies by the mappers created by newMapper,
+// with the key func the dependencies are collected by
+func GetLocalCollectorGenerator(newMapper collectable.MapperFactory) Generator {
+	return func(cf collectable.FileOperator, base, objectKey string, generator Generator, options ...Option) (Collector, error) {
+		configs, options := withKeyFunc(options)
+		mapper, err := newMapper(configs.KeyFunc)
+		if err != nil {
+			return nil, err
+		}
+		collector, err := newAsyncCollector(
+			cf, base, objectKey, LocalFileFreshValidator, LocalMover, mapper, generator, options...)
+		if err != nil {
+			return nil, err
+		}
+		return collector, nil
+	}
+}
+
+// GetMappedLocalCollectorGenerator Returns a collector generator which collect
+// to local and refer to the dependencies by the uris mapped by mapper
+func GetMappedLocalCollectorGenerator(mapper collectable.DependencyMapper) Generator {
 	return func(cf collectable.FileOperator, base, objectKey string, generator Generator, options ...Option) (Collector, error) {
-		collector, err := NewAsyncCollector(
-			cf, base, objectKey, LocalFileFreshValidator, LocalMover, urimapper, generator, options...)
+		collector, err := newAsyncCollector(
+			cf, base, objectKey, LocalFileFreshValidator, LocalMover, mapper, generator, options...)
 		if err != nil {
 			return nil, err
 		}
 		return collector, nil
 	}
 }
+
+// inlinedCollector Collector for the dependencies which have been embedded into
+// the files referring to them, there is nothing to collect
+type inlinedCollector struct{}
+
+// Collect Complete at once
+func (inlinedCollector) Collect(ctx context.Context) <-chan error {
+	complete := make(chan error, 1)
+	complete <- nil
+	return complete
+}
+
+// GetInlineCollectorGenerator Returns a collector generator which skips the
+// dependencies embedded by the inliner, and generates collectors for the others
+// by generator
+func GetInlineCollectorGenerator(inliner *collectable.Inliner, generator Generator) Generator {
+	return func(cf collectable.FileOperator, base, objectKey string, depGenerator Generator, options ...Option) (Collector, error) {
+		if inliner.IsInlined(cf) {
+			return inlinedCollector{}, nil
+		}
+		return generator(cf, base, objectKey, depGenerator, options...)
+	}
+}
@@ -3,10 +3,13 @@ package collector
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/slipfre/imgmd/collectable"
 	"github.com/slipfre/imgmd/provider"
@@ -88,3 +91,122 @@ func TestOBSAsyncCollector_testCollectMDWithMediasToOBS(t *testing.T) {
 		require.Nil(t, err)
 	}
 }
+
+func TestAsyncCollector_testCollectNestedDependencies(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	files := map[string]string{
+		"doc.md":                 "<link rel=\"stylesheet\" href=\"theme/style.css\">\n\n![Logo](img/logo.png)\n",
+		"theme/style.css":        "@font-face { src: url(fonts/font.woff2); }\n",
+		"theme/fonts/font.woff2": "font",
+		"img/logo.png":           "logo",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0777))
+		require.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+	}
+
+	md := collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+	require.Nil(t, md.FileError())
+
+	mdCollector, err := LocalCollectorGenerator(md, dest, "doc.md", LocalCollectorGenerator)
+	require.Nil(t, err)
+	require.Nil(t, <-mdCollector.Collect(context.Background()))
+
+	doc, err := ioutil.ReadFile(filepath.Join(dest, "doc.md"))
+	require.Nil(t, err)
+	require.Equal(t, "<link rel=\"stylesheet\" href=\"doc_medias/style.css\">\n\n![Logo](doc_medias/logo.png)\n", string(doc))
+
+	css, err := ioutil.ReadFile(filepath.Join(dest, "doc_medias", "style.css"))
+	require.Nil(t, err)
+	require.Equal(t, "@font-face { src: url(style_medias/font.woff2); }\n", string(css))
+
+	require.FileExists(t, filepath.Join(dest, "doc_medias", "logo.png"))
+	require.FileExists(t, filepath.Join(dest, "doc_medias", "style_medias", "font.woff2"))
+}
+
+func TestAsyncCollector_testCollectCrossLinkedDocuments(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "a.org"), "[[file:b.org]]\n")
+	writeTestFile(t, filepath.Join(src, "b.org"), "[[file:a.org]]\n")
+
+	// Documents linking to each other are collected once
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	org := collectable.NewOrgFile("", filepath.Join(src, "a.org"))
+	orgCollector, err := LocalCollectorGenerator(org, dest, "a.org", LocalCollectorGenerator)
+	require.Nil(t, err)
+	require.Nil(t, <-orgCollector.Collect(ctx))
+	require.Equal(t, "[[file:a_medias/b.org]]\n", readTestFile(t, filepath.Join(dest, "a.org")))
+	require.Equal(t, "[[file:a.org]]\n", readTestFile(t, filepath.Join(dest, "a_medias", "b.org")))
+}
+
+func TestAsyncCollector_testCollectSameNames(t *testing.T) {
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"doc.md":           "![a](a/screenshot.png) ![b](b/screenshot.png)\n",
+		"a/screenshot.png": "a",
+		"b/screenshot.png": "b",
+	} {
+		path := filepath.Join(src, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0777))
+		require.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+	}
+
+	// The references are rewritten by the keys the dependencies are collected
+	// to, whichever generator the document is collected by
+	generators := map[string]Generator{
+		"LocalCollectorGenerator":    LocalCollectorGenerator,
+		"GetLocalCollectorGenerator": GetLocalCollectorGenerator(collectable.LocalMapperFactory),
+		"NewAsyncCollector": func(cf collectable.FileOperator, base, objectKey string, depGenerator Generator, options ...Option) (Collector, error) {
+			return NewAsyncCollector(cf, base, objectKey, LocalFileFreshValidator, LocalMover, collectable.LocalMapperFactory, depGenerator, options...)
+		},
+	}
+	for name, generator := range generators {
+		dest := t.TempDir()
+		md := collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+		mdCollector, err := generator(md, dest, "doc.md", LocalCollectorGenerator)
+		require.Nil(t, err, name)
+		require.Nil(t, <-mdCollector.Collect(context.Background()), name)
+
+		data, err := ioutil.ReadFile(filepath.Join(dest, "doc.md"))
+		require.Nil(t, err, name)
+		uris := regexp.MustCompile(`\]\(([^)]+)\)`).FindAllStringSubmatch(string(data), -1)
+		require.Len(t, uris, 2, name)
+		require.NotEqual(t, uris[0][1], uris[1][1], name)
+		for i, content := range []string{"a", "b"} {
+			collected, err := ioutil.ReadFile(filepath.Join(dest, filepath.FromSlash(uris[i][1])))
+			require.Nil(t, err, name)
+			require.Equal(t, content, string(collected), name)
+		}
+	}
+}
+
+func TestAsyncCollector_testCollectSameNamesDeterministic(t *testing.T) {
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"doc.md":           "![b](b/screenshot.png) ![a](a/screenshot.png)\n",
+		"a/screenshot.png": "a",
+		"b/screenshot.png": "b",
+	} {
+		path := filepath.Join(src, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0777))
+		require.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+	}
+
+	// Each run gets its own keys, which do not depend on the order of the
+	// references or where the files are
+	for i := 0; i < 2; i++ {
+		dest := t.TempDir()
+		md := collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+		mdCollector, err := LocalCollectorGenerator(md, dest, "doc.md", LocalCollectorGenerator)
+		require.Nil(t, err)
+		require.Nil(t, <-mdCollector.Collect(context.Background()))
+
+		data, err := ioutil.ReadFile(filepath.Join(dest, "doc.md"))
+		require.Nil(t, err)
+		require.Equal(t, "![b](doc_medias/screenshot-a5471efb.png) ![a](doc_medias/screenshot.png)\n", string(data))
+	}
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/slipfre/imgmd/collectable"
+)
+
+// sharedCollector Collector shared by all the files collected to the same
+// place, which collects only once and reports the result to every caller.
+// It collects with its own context, so that a caller being cancelled does not
+// fail the others. The files it collects are journaled in the transaction of
+// every caller, and its events are reported to the observer of every caller
+// as the ones of its document
+type sharedCollector struct {
+	ctx         context.Context
+	collector   Collector
+	transaction *Transaction
+	once        sync.Once
+	done        chan struct{}
+	err         error
+	mutex       sync.Mutex
+	events      []Event
+	subscribers []subscriber
+}
+
+// subscriber The observer of a caller and the document it collects for
+type subscriber struct {
+	observer Observer
+	document string
+}
+
+// Collect Collect once for all the callers, and complete once it is done or
+// ctx is done
+func (s *sharedCollector) Collect(ctx context.Context) <-chan error {
+	s.once.Do(func() {
+		go func() {
+			s.err = <-s.collector.Collect(s.ctx)
+			close(s.done)
+		}()
+	})
+	complete := make(chan error, 1)
+	go func() {
+		select {
+		case <-s.done:
+			complete <- s.err
+		case <-ctx.Done():
+			complete <- ctx.Err()
+		}
+	}()
+	return complete
+}
+
+// join Add the caller of the configs, it fails if the files collected may have
+// been undone, since every caller has been rolled back
+func (s *sharedCollector) join(configs *Configs) bool {
+	if s.transaction != nil && configs.Transaction != nil && !s.transaction.join(configs.Transaction) {
+		return false
+	}
+	if configs.Observer == nil {
+		return true
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sub := subscriber{observer: configs.Observer, document: configs.Document}
+	s.subscribers = append(s.subscribers, sub)
+	// The events reported before the caller joined are replayed to it
+	for _, event := range s.events {
+		sub.notify(event)
+	}
+	return true
+}
+
+// observe Report the event to the observers of all the callers
+func (s *sharedCollector) observe(event Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, event)
+	for _, sub := range s.subscribers {
+		sub.notify(event)
+	}
+}
+
+func (sub subscriber) notify(event Event) {
+	event.Document = sub.document
+	sub.observer(event)
+}
+
+// GetDedupeCollectorGenerator Returns a collector generator which generates
+// collectors by generator, and shares one collector among the files collected
+// to the same place, so that identical dependencies referred by many files are
+// collected once in a run. The shared collectors are cancelled when ctx is done
+func GetDedupeCollectorGenerator(ctx context.Context, generator Generator) Generator {
+	mutex := sync.Mutex{}
+	collectors := make(map[string]*sharedCollector)
+	return func(cf collectable.FileOperator, base, objectKey string, depGenerator Generator, options ...Option) (Collector, error) {
+		configs := applyOptions(options...)
+		target := filepath.Join(base, objectKey)
+		mutex.Lock()
+		defer mutex.Unlock()
+		if shared, ok := collectors[target]; ok && shared.join(configs) {
+			return shared, nil
+		}
+
+		shared := &sharedCollector{ctx: ctx, done: make(chan struct{})}
+		if configs.Transaction != nil {
+			shared.transaction = configs.Transaction.journal.share()
+		}
+		shared.join(configs)
+		// The observer and the transaction of the caller are replaced by the
+		// shared ones, which relay to every caller
+		sharedOptions := make([]Option, 0, len(options)+2)
+		sharedOptions = append(sharedOptions, options...)
+		sharedOptions = append(sharedOptions, func(configs *Configs) {
+			configs.Observer = shared.observe
+		}, withTransaction(shared.transaction))
+		collector, err := generator(cf, base, objectKey, depGenerator, sharedOptions...)
+		if err != nil {
+			return nil, err
+		}
+		shared.collector = collector
+		collectors[target] = shared
+		return shared, nil
+	}
+}
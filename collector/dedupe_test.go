@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/slipfre/imgmd/collectable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDedupeCollectorGenerator(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	files := map[string]string{
+		"a/doc.md":   "![logo](logo.png)\n",
+		"a/logo.png": "logo",
+		"b/doc.md":   "![logo](copy.png) ![logo](../a/logo.png)\n",
+		"b/copy.png": "logo",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0777))
+		require.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+	}
+
+	var moved int32
+	counted := func(cf collectable.FileOperator, base, objectKey string, depGenerator Generator, options ...Option) (Collector, error) {
+		return newAsyncCollector(cf, base, objectKey, LocalFileFreshValidator, func(cf collectable.FileOperator, base, objectKey string) error {
+			atomic.AddInt32(&moved, 1)
+			return LocalMover(cf, base, objectKey)
+		}, collectable.NewLocalDependencyMapper(applyOptions(options...).KeyFunc), depGenerator, options...)
+	}
+	generator := GetDedupeCollectorGenerator(context.Background(), counted)
+	key := collectable.NewContentAddresser("_medias").Key
+
+	completes := make([]<-chan error, 0)
+	for _, name := range []string{"a", "b"} {
+		md := collectable.NewMarkdownFile("", filepath.Join(src, name, "doc.md"))
+		mdCollector, err := GetMappedLocalCollectorGenerator(collectable.NewLocalDependencyMapper(key))(
+			md, dest, filepath.Join(name, "doc.md"), generator, WithKeyFunc(key))
+		require.Nil(t, err)
+		completes = append(completes, mdCollector.Collect(context.Background()))
+	}
+	for err := range Merge(completes...) {
+		require.Nil(t, err)
+	}
+
+	require.Equal(t, int32(1), moved)
+	medias, err := ioutil.ReadDir(filepath.Join(dest, "_medias"))
+	require.Nil(t, err)
+	require.Len(t, medias, 1)
+
+	uri := "../_medias/" + medias[0].Name()
+	a, err := ioutil.ReadFile(filepath.Join(dest, "a", "doc.md"))
+	require.Nil(t, err)
+	require.Equal(t, "![logo]("+uri+")\n", string(a))
+	b, err := ioutil.ReadFile(filepath.Join(dest, "b", "doc.md"))
+	require.Nil(t, err)
+	require.Equal(t, "![logo]("+uri+") ![logo]("+uri+")\n", string(b))
+}
+
+func TestGetDedupeCollectorGenerator_rollback(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	files := map[string]string{
+		"a/doc.md":   "![logo](logo.png)\n",
+		"a/logo.png": "logo",
+		"b/doc.md":   "![logo](logo.png)\n",
+		"b/logo.png": "logo",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0777))
+		require.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+	}
+
+	generator := GetDedupeCollectorGenerator(context.Background(), LocalCollectorGenerator)
+	key := collectable.NewContentAddresser("_medias").Key
+	mapper := collectable.NewLocalDependencyMapper(key)
+	journal := NewJournal()
+	mutex := sync.Mutex{}
+	events := make(map[string][]Event)
+	observer := func(event Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events[event.Document] = append(events[event.Document], event)
+	}
+
+	// b fails after its dependencies are collected, and is rolled back
+	b := collectable.NewMarkdownFile("", filepath.Join(src, "b", "doc.md"))
+	bCollector, err := newAsyncCollector(b, dest, "b/doc.md", LocalFileFreshValidator, func(cf collectable.FileOperator, base, objectKey string) error {
+		return errors.New("failed")
+	}, mapper, generator, WithKeyFunc(key), WithJournal(journal), WithObserver(observer))
+	require.Nil(t, err)
+	require.NotNil(t, <-bCollector.Collect(context.Background()))
+	medias, err := ioutil.ReadDir(filepath.Join(dest, "_medias"))
+	require.True(t, os.IsNotExist(err) || len(medias) == 0)
+
+	a := collectable.NewMarkdownFile("", filepath.Join(src, "a", "doc.md"))
+	aCollector, err := GetMappedLocalCollectorGenerator(mapper)(
+		a, dest, "a/doc.md", generator, WithKeyFunc(key), WithJournal(journal), WithObserver(observer))
+	require.Nil(t, err)
+	require.Nil(t, <-aCollector.Collect(context.Background()))
+
+	medias, err = ioutil.ReadDir(filepath.Join(dest, "_medias"))
+	require.Nil(t, err)
+	require.Len(t, medias, 1)
+	target := filepath.Join(dest, "_medias", medias[0].Name())
+	for _, document := range []string{a.GetURI(), b.GetURI()} {
+		rewritten := false
+		for _, event := range events[document] {
+			if event.Type == EventRewritten && event.Target == target {
+				rewritten = true
+			}
+		}
+		require.True(t, rewritten, document)
+	}
+}
@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Stage The stage of collecting a file
+type Stage string
+
+const (
+	// StageRead Reading the file, finding and replacing its dependencies
+	StageRead Stage = "read"
+	// StageFreshCheck Validating whether the collected file is up to date
+	StageFreshCheck Stage = "fresh-check"
+	// StageUpload Uploading the file to obs
+	StageUpload Stage = "upload"
+	// StageWrite Writing the file to local, or recording it in the manifest
+	StageWrite Stage = "write"
+	// StageRollback Undoing the files created for the document
+	StageRollback Stage = "rollback"
+)
+
+// FileError Error of collecting a file. Dependency is empty if the document
+// itself failed, and Err is the original error such as the one of the provider
+type FileError struct {
+	Document   string
+	Dependency string
+	Target     string
+	Stage      Stage
+	Err        error
+}
+
+func (e *FileError) Error() string {
+	builder := strings.Builder{}
+	if e.Dependency != "" {
+		builder.WriteString(fmt.Sprintf("collect '%s'", e.Dependency))
+		if e.Document != "" {
+			builder.WriteString(fmt.Sprintf(" of '%s'", e.Document))
+		}
+	} else {
+		builder.WriteString(fmt.Sprintf("collect '%s'", e.Document))
+	}
+	if e.Stage != "" {
+		builder.WriteString(fmt.Sprintf(" (%s)", e.Stage))
+	}
+	builder.WriteString(": ")
+	builder.WriteString(e.Err.Error())
+	return builder.String()
+}
+
+// Unwrap Returns the original error
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError Errors of collecting the files of a document
+type MultiError struct {
+	Errors []*FileError
+}
+
+func (e *MultiError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// FileErrors Returns the FileErrors err consists of, err which is neither a
+// FileError nor a MultiError is returned as a FileError without details
+func FileErrors(err error) []*FileError {
+	if err == nil {
+		return nil
+	}
+	var multiError *MultiError
+	if errors.As(err, &multiError) {
+		return multiError.Errors
+	}
+	var fileError *FileError
+	if errors.As(err, &fileError) {
+		return []*FileError{fileError}
+	}
+	return []*FileError{{Err: err}}
+}
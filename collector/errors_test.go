@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/slipfre/imgmd/collectable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncCollector_testCollectKeepGoing(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	for _, name := range []string{"a.png", "b.png", "c.png", "d.png"} {
+		writeTestFile(t, filepath.Join(src, name), name)
+	}
+	writeTestFile(t, filepath.Join(src, "doc.md"), "![a](a.png) ![b](b.png) ![c](c.png) ![d](d.png)\n")
+
+	collect := func(bucket *failingBucket, keepGoing bool) error {
+		md := collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+		collector, err := GetLocalCollectorGenerator(collectable.LocalMapperFactory)(
+			md, dest, "doc.md", GetOBSCollectorGenerator(bucket), WithKeepGoing(keepGoing))
+		require.Nil(t, err)
+		return <-collector.Collect(context.Background())
+	}
+
+	bucket := &failingBucket{memoryBucket: newMemoryBucket(), key: "doc_medias/b.png"}
+	require.Nil(t, os.Remove(filepath.Join(src, "d.png")))
+	err := collect(bucket, true)
+	require.NotNil(t, err)
+	var multiError *MultiError
+	require.True(t, errors.As(err, &multiError))
+	require.Len(t, multiError.Errors, 2)
+
+	errs := make(map[string]*FileError)
+	for _, fileError := range multiError.Errors {
+		require.Equal(t, filepath.Join(src, "doc.md"), fileError.Document)
+		errs[filepath.Base(fileError.Dependency)] = fileError
+	}
+	require.Equal(t, StageUpload, errs["b.png"].Stage)
+	require.Equal(t, filepath.Join(dest, "doc_medias", "b.png"), errs["b.png"].Target)
+	require.Equal(t, "failed to put doc_medias/b.png", errs["b.png"].Err.Error())
+	require.Equal(t, StageRead, errs["d.png"].Stage)
+	require.True(t, errors.Is(errs["d.png"], os.ErrNotExist))
+
+	// All the other dependencies are collected, while the document is not
+	require.Len(t, bucket.objects, 2)
+	require.NoFileExists(t, filepath.Join(dest, "doc.md"))
+
+	// Without keepGoing, the first error is reported
+	err = collect(&failingBucket{memoryBucket: newMemoryBucket(), key: "doc_medias/b.png"}, false)
+	require.NotNil(t, err)
+	require.Len(t, FileErrors(err), 1)
+}
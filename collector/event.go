@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/slipfre/imgmd/manifest"
+)
+
+// EventType The type of the events of collectors
+type EventType string
+
+const (
+	// EventDocumentStarted The collector of a document started
+	EventDocumentStarted EventType = "document-started"
+	// EventDependencyDiscovered A dependency of the file is found, Target is
+	// where it is collected to
+	EventDependencyDiscovered EventType = "dependency-discovered"
+	// EventSkippedFresh The file is skipped since the collected one is up to
+	// date
+	EventSkippedFresh EventType = "skipped-fresh"
+	// EventUploadProgress Transferred of Total bytes of the file are uploaded,
+	// Total is -1 if unknown
+	EventUploadProgress EventType = "upload-progress"
+	// EventUploaded The file is uploaded to obs
+	EventUploaded EventType = "uploaded"
+	// EventRewritten The file is written to local, with the uris of its
+	// dependencies rewritten
+	EventRewritten EventType = "rewritten"
+	// EventFailed The file failed, Err is a FileError
+	EventFailed EventType = "failed"
+	// EventFinished The collector of a document finished, Err is nil if the
+	// document and all its dependencies are collected
+	EventFinished EventType = "finished"
+)
+
+// Event An event of collecting File for Document. File is the source uri of the
+// document itself or one of its dependencies
+type Event struct {
+	Type        EventType
+	Time        time.Time
+	Document    string
+	File        string
+	Target      string
+	Location    manifest.Location
+	Transferred int64
+	Total       int64
+	Err         error
+}
+
+// Observer Observes the events of collectors. It is called from the Goroutines
+// of the collectors, so it should be safe for concurrent use and return soon
+type Observer func(event Event)
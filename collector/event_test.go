@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/slipfre/imgmd/collectable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncCollector_testCollectWithObserver(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "doc.md"), "<link rel=\"stylesheet\" href=\"style.css\">\n\n![a](a.png) ![b](b.png)\n")
+	writeTestFile(t, filepath.Join(src, "style.css"), "p { background: url(bg.png); }\n")
+	writeTestFile(t, filepath.Join(src, "bg.png"), "bg")
+	writeTestFile(t, filepath.Join(src, "a.png"), "a")
+	writeTestFile(t, filepath.Join(src, "b.png"), "b")
+
+	mutex := sync.Mutex{}
+	var events []Event
+	observer := func(event Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}
+	bucket := &failingBucket{memoryBucket: newMemoryBucket()}
+	collect := func() error {
+		events = nil
+		md := collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+		collector, err := GetLocalCollectorGenerator(collectable.LocalMapperFactory)(
+			md, dest, "doc.md", GetPartOBSCollectorGenerator(bucket, map[collectable.FileType]struct{}{collectable.Leaf: {}}), WithObserver(observer))
+		require.Nil(t, err)
+		return <-collector.Collect(context.Background())
+	}
+	files := func(eventType EventType) map[string]Event {
+		files := make(map[string]Event)
+		for _, event := range events {
+			require.Equal(t, filepath.Join(src, "doc.md"), event.Document)
+			if event.Type == eventType {
+				files[filepath.Base(event.File)] = event
+			}
+		}
+		return files
+	}
+
+	require.Nil(t, collect())
+	require.Equal(t, EventDocumentStarted, events[0].Type)
+	require.Equal(t, EventFinished, events[len(events)-1].Type)
+	require.Nil(t, events[len(events)-1].Err)
+	discovered := files(EventDependencyDiscovered)
+	require.Len(t, discovered, 4)
+	require.Equal(t, filepath.Join(dest, "doc_medias", "style_medias", "bg.png"), discovered["bg.png"].Target)
+	uploaded := files(EventUploaded)
+	require.Len(t, uploaded, 3)
+	require.Equal(t, "https://bucket.test/doc_medias/a.png", uploaded["a.png"].Location.URL)
+	progress := files(EventUploadProgress)
+	require.Len(t, progress, 3)
+	require.Equal(t, int64(1), progress["a.png"].Transferred)
+	require.Equal(t, int64(1), progress["a.png"].Total)
+	rewritten := files(EventRewritten)
+	require.Len(t, rewritten, 2)
+	require.Equal(t, filepath.Join(dest, "doc.md"), rewritten["doc.md"].Location.Path)
+
+	// The collected files are skipped as fresh
+	require.Nil(t, collect())
+	require.Len(t, files(EventSkippedFresh), 5)
+	require.Empty(t, files(EventUploaded))
+
+	writeTestFile(t, filepath.Join(src, "b.png"), "new b")
+	bucket.key = "doc_medias/b.png"
+	require.NotNil(t, collect())
+	failed := files(EventFailed)
+	require.Contains(t, failed, "b.png")
+	require.Equal(t, StageUpload, failed["b.png"].Err.(*FileError).Stage)
+	require.Equal(t, failed["b.png"].Err.(*FileError).Err, FileErrors(events[len(events)-1].Err)[0].Err)
+}
@@ -3,52 +3,75 @@ package collector
 import (
 	"errors"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/slipfre/imgmd/collectable"
 	"github.com/slipfre/imgmd/provider"
 	"github.com/slipfre/imgmd/utils"
 )
 
-// LocalFileFreshValidator Validate whether the local file is up to date
+var md5Regex = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+// LocalFileFreshValidator Validate whether the local file is up to date, by
+// comparing the sha256 of its content with the one of the collectable file
 func LocalFileFreshValidator(cf collectable.FileOperator, base, objectKey string) (bool, error) {
 	targetPath := filepath.Join(base, objectKey)
-	if utils.IsFileExist(targetPath) {
-		updatedTime, _ := utils.GetUpdatedTime(targetPath)
-		isUpdatedSince, err := cf.IsUpdatedSince(updatedTime)
-		if err != nil {
-			return false, err
-		}
-		if !isUpdatedSince {
-			// No need for collecting
-			return false, nil
-		}
+	if !utils.IsFileExist(targetPath) {
+		return true, nil
+	}
+	target, err := utils.DigestOfFile(targetPath)
+	if err != nil {
+		// Overwrite the file which can not be read
+		return true, nil
 	}
-	return true, nil
+	source, err := digestOf(cf)
+	if err != nil {
+		return false, err
+	}
+	return source.SHA256 != target.SHA256, nil
 }
 
-// GetOBSFileFreshValidator Get a FreshValidator which validates whether the obs file is up to date
+// GetOBSFileFreshValidator Get a FreshValidator which validates whether the obs
+// file is up to date, by comparing the digest of the object with the one of
+// the collectable file. The sha256 recorded in the metadata of the object is
+// compared first, then the crc64 and the etag which is the md5 of the objects
+// uploaded at once. The object is regarded as stale if none of them is known
 func GetOBSFileFreshValidator(bucket provider.Bucket) (FreshValidator, error) {
 	if bucket == nil {
 		return nil, errors.New("bucket should not be nil")
 	}
 	return func(cf collectable.FileOperator, base, objectKey string) (bool, error) {
-		exist, err := bucket.IsObjectExist(objectKey)
+		target, err := bucket.GetObjectDigest(filepath.ToSlash(objectKey))
+		if err != nil {
+			return false, err
+		}
+		if target == nil {
+			return true, nil
+		}
+		source, err := digestOf(cf)
 		if err != nil {
 			return false, err
 		}
-		if exist {
-			updatedTime, err := bucket.GetObjectLastModified(objectKey)
-			if err != nil {
-				return false, err
-			}
-			isUpdatedSince, err := cf.IsUpdatedSince(updatedTime)
-			if err != nil {
-				return false, err
-			}
-			if !isUpdatedSince {
-				return false, nil
-			}
+		switch {
+		case target.SHA256 != "":
+			return target.SHA256 != source.SHA256, nil
+		case target.CRC64 != "":
+			return target.CRC64 != strconv.FormatUint(source.CRC64, 10), nil
+		case md5Regex.MatchString(target.ETag):
+			return !strings.EqualFold(target.ETag, source.MD5), nil
 		}
 		return true, nil
 	}, nil
 }
+
+// digestOf Returns the digest of the content which is collected for cf
+func digestOf(cf collectable.FileOperator) (*utils.Digest, error) {
+	reader, err := collectable.Open(cf)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return utils.DigestOf(reader)
+}
@@ -0,0 +1,253 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slipfre/imgmd/collectable"
+	"github.com/slipfre/imgmd/provider"
+	"github.com/slipfre/imgmd/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBucket A bucket keeping objects in memory
+type memoryBucket struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+	meta    map[string]map[string]string
+	puts    int
+}
+
+func newMemoryBucket() *memoryBucket {
+	return &memoryBucket{
+		objects: make(map[string][]byte),
+		meta:    make(map[string]map[string]string),
+	}
+}
+
+func (b *memoryBucket) PutObjectFromFile(objectKey, filePath string, options ...provider.ObjectOption) (string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	return b.PutObjectFromBytes(objectKey, data, options...)
+}
+
+func (b *memoryBucket) PutObjectFromBytes(objectKey string, data []byte, options ...provider.ObjectOption) (string, error) {
+	config := provider.DefaultOptionConfig()
+	for _, option := range options {
+		option(config)
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.objects[objectKey] = data
+	b.meta[objectKey] = config.Meta
+	b.puts++
+	return b.GetObjectURL(objectKey), nil
+}
+
+func (b *memoryBucket) PutObject(objectKey string, reader io.Reader, options ...provider.ObjectOption) (string, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return b.PutObjectFromBytes(objectKey, data, options...)
+}
+
+func (b *memoryBucket) DeleteObject(objectKey string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.objects, objectKey)
+	delete(b.meta, objectKey)
+	return nil
+}
+
+func (b *memoryBucket) IsObjectExist(objectKey string) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	_, ok := b.objects[objectKey]
+	return ok, nil
+}
+
+func (b *memoryBucket) GetObjectLastModified(objectKey string) (*time.Time, error) {
+	now := time.Now()
+	return &now, nil
+}
+
+func (b *memoryBucket) GetObjectDigest(objectKey string) (*provider.ObjectDigest, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	data, ok := b.objects[objectKey]
+	if !ok {
+		return nil, nil
+	}
+	digest, err := utils.DigestOf(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &provider.ObjectDigest{
+		ETag:   digest.MD5,
+		CRC64:  strconv.FormatUint(digest.CRC64, 10),
+		SHA256: b.meta[objectKey][provider.MetaSHA256],
+	}, nil
+}
+
+func (b *memoryBucket) GetObjectURL(objectKey string) string {
+	return "https://bucket.test/" + objectKey
+}
+
+func (b *memoryBucket) GetName() string {
+	return "bucket"
+}
+
+func TestLocalFileFreshValidator(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "a.png"), []byte("a"), 0666))
+
+	cf := collectable.NewLeafFile("", filepath.Join(src, "a.png"))
+	needCollect, err := LocalFileFreshValidator(cf, dest, "a.png")
+	require.Nil(t, err)
+	require.True(t, needCollect)
+
+	// Touching the files does not make them stale
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dest, "a.png"), []byte("a"), 0666))
+	future := time.Now().Add(time.Hour)
+	require.Nil(t, os.Chtimes(filepath.Join(src, "a.png"), future, future))
+	needCollect, err = LocalFileFreshValidator(collectable.NewLeafFile("", filepath.Join(src, "a.png")), dest, "a.png")
+	require.Nil(t, err)
+	require.False(t, needCollect)
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dest, "a.png"), []byte("b"), 0666))
+	needCollect, err = LocalFileFreshValidator(cf, dest, "a.png")
+	require.Nil(t, err)
+	require.True(t, needCollect)
+}
+
+func TestGetOBSFileFreshValidator(t *testing.T) {
+	src := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "a.png"), []byte("a"), 0666))
+	cf := collectable.NewLeafFile("", filepath.Join(src, "a.png"))
+
+	bucket := newMemoryBucket()
+	validator, err := GetOBSFileFreshValidator(bucket)
+	require.Nil(t, err)
+	mover, err := GetOBSMover(bucket)
+	require.Nil(t, err)
+
+	needCollect, err := validator(cf, "", "a.png")
+	require.Nil(t, err)
+	require.True(t, needCollect)
+
+	// The mover records the sha256 of the content
+	require.Nil(t, mover(cf, "", "a.png"))
+	digest, err := utils.DigestOfFile(filepath.Join(src, "a.png"))
+	require.Nil(t, err)
+	require.Equal(t, digest.SHA256, bucket.meta["a.png"][provider.MetaSHA256])
+	needCollect, err = validator(cf, "", "a.png")
+	require.Nil(t, err)
+	require.False(t, needCollect)
+
+	// Objects uploaded by others are validated by crc64 or etag
+	_, err = bucket.PutObjectFromBytes("a.png", []byte("a"))
+	require.Nil(t, err)
+	needCollect, err = validator(cf, "", "a.png")
+	require.Nil(t, err)
+	require.False(t, needCollect)
+
+	_, err = bucket.PutObjectFromBytes("a.png", []byte("b"), provider.WithMeta(provider.MetaSHA256, "stale"))
+	require.Nil(t, err)
+	needCollect, err = validator(cf, "", "a.png")
+	require.Nil(t, err)
+	require.True(t, needCollect)
+}
+
+func TestAsyncCollector_testCollectFresh(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "doc.md"), []byte("![a](a.png) ![b](b.png)\n"), 0666))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "a.png"), []byte("a"), 0666))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "b.png"), []byte("b"), 0666))
+
+	bucket := newMemoryBucket()
+	collect := func() {
+		md := collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+		mdCollector, err := GetLocalCollectorGenerator(collectable.GetOBSMapperFactory(bucket))(md, dest, "doc.md", GetOBSCollectorGenerator(bucket))
+		require.Nil(t, err)
+		require.Nil(t, <-mdCollector.Collect(context.Background()))
+	}
+
+	collect()
+	require.Equal(t, 2, bucket.puts)
+
+	// Nothing is collected again after the files are touched
+	future := time.Now().Add(time.Hour)
+	for _, name := range []string{"doc.md", "a.png", "b.png"} {
+		require.Nil(t, os.Chtimes(filepath.Join(src, name), future, future))
+	}
+	docInfo, err := os.Stat(filepath.Join(dest, "doc.md"))
+	require.Nil(t, err)
+	collect()
+	require.Equal(t, 2, bucket.puts)
+	info, err := os.Stat(filepath.Join(dest, "doc.md"))
+	require.Nil(t, err)
+	require.Equal(t, docInfo.ModTime(), info.ModTime())
+
+	// Only the changed dependency is uploaded
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "b.png"), []byte("changed"), 0666))
+	collect()
+	require.Equal(t, 3, bucket.puts)
+}
+
+func TestAsyncCollector_testCollectFreshBeforeDependencies(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "doc.md"), "![a](a.png)\n")
+	writeTestFile(t, filepath.Join(src, "a.png"), "a")
+
+	mutex := sync.Mutex{}
+	var steps []string
+	log := func(step string, cf collectable.FileOperator) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		steps = append(steps, step+" "+filepath.Base(cf.GetURI()))
+	}
+	var generator Generator
+	generator = func(cf collectable.FileOperator, base, objectKey string, depGenerator Generator, options ...Option) (Collector, error) {
+		configs, options := withKeyFunc(options)
+		return newAsyncCollector(cf, base, objectKey, func(cf collectable.FileOperator, base, objectKey string) (bool, error) {
+			log("check", cf)
+			return LocalFileFreshValidator(cf, base, objectKey)
+		}, func(cf collectable.FileOperator, base, objectKey string) error {
+			log("move", cf)
+			return LocalMover(cf, base, objectKey)
+		}, collectable.NewLocalDependencyMapper(configs.KeyFunc), depGenerator, options...)
+	}
+	collect := func() {
+		steps = nil
+		md := collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+		mdCollector, err := generator(md, dest, "doc.md", generator)
+		require.Nil(t, err)
+		require.Nil(t, <-mdCollector.Collect(context.Background()))
+	}
+
+	// The document is validated by its own digest before its dependencies are
+	// collected
+	collect()
+	require.Equal(t, []string{"check doc.md", "check a.png", "move a.png", "move doc.md"}, steps)
+
+	// A dependency changed on its own is collected, while the fresh document
+	// is skipped
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "a.png"), []byte("changed"), 0666))
+	collect()
+	require.Equal(t, []string{"check doc.md", "check a.png", "move a.png"}, steps)
+	require.Equal(t, "changed", readTestFile(t, filepath.Join(dest, "doc_medias", "a.png")))
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/slipfre/imgmd/collectable"
+	"github.com/slipfre/imgmd/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncCollector_testCollectWithManifest(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	files := map[string]string{
+		"doc.md":    "<link rel=\"stylesheet\" href=\"style.css\">\n\n![a](a.png)\n",
+		"style.css": "p { background: url(bg.png); }\n",
+		"bg.png":    "bg",
+		"a.png":     "a",
+	}
+	for name, content := range files {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(src, name), []byte(content), 0666))
+	}
+
+	m, err := manifest.Open(dest)
+	require.Nil(t, err)
+	bucket := newMemoryBucket()
+	md := collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+	mdCollector, err := GetLocalCollectorGenerator(collectable.LocalMapperFactory)(
+		md, dest, "doc.md", GetPartOBSCollectorGenerator(bucket, map[collectable.FileType]struct{}{collectable.Leaf: {}}), WithManifest(m))
+	require.Nil(t, err)
+	require.Nil(t, <-mdCollector.Collect(context.Background()))
+
+	// The manifest is saved at the end of the run
+	require.NoFileExists(t, filepath.Join(dest, manifest.Dir, manifest.FileName))
+	require.Nil(t, m.Save())
+	require.FileExists(t, filepath.Join(dest, manifest.Dir, manifest.FileName))
+	reopened, err := manifest.Open(dest)
+	require.Nil(t, err)
+	documents := reopened.Documents()
+	require.Len(t, documents, 1)
+	document := documents[0]
+	require.Equal(t, "doc.md", document.Key)
+	// The paths are relative to the root of the manifest
+	srcDir, err := filepath.Rel(dest, src)
+	require.Nil(t, err)
+	require.Equal(t, filepath.ToSlash(filepath.Join(srcDir, "doc.md")), document.Source)
+	require.Equal(t, "doc.md", document.Location.Path)
+
+	sources := make(map[string]manifest.Dependency)
+	for _, dependency := range document.Dependencies {
+		sources[filepath.Base(dependency.Source)] = dependency
+	}
+	require.Len(t, sources, 3)
+	require.Equal(t, "doc_medias/style.css", sources["style.css"].Location.Path)
+	require.Equal(t, filepath.ToSlash(filepath.Join(srcDir, "style.css")), sources["bg.png"].Referrer)
+	require.Equal(t, "bucket", sources["a.png"].Location.Bucket)
+	require.Equal(t, "doc_medias/a.png", sources["a.png"].Location.Key)
+	require.Equal(t, "https://bucket.test/doc_medias/a.png", sources["a.png"].Location.URL)
+	require.NotEmpty(t, sources["a.png"].SHA256)
+
+	// The document is recorded again without the removed dependency
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "doc.md"), []byte("![a](a.png)\n"), 0666))
+	require.Nil(t, os.Remove(filepath.Join(src, "style.css")))
+	md = collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+	mdCollector, err = GetLocalCollectorGenerator(collectable.LocalMapperFactory)(
+		md, dest, "doc.md", GetOBSCollectorGenerator(bucket), WithManifest(m))
+	require.Nil(t, err)
+	require.Nil(t, <-mdCollector.Collect(context.Background()))
+	documents = m.Documents()
+	require.Len(t, documents, 1)
+	require.Len(t, documents[0].Dependencies, 1)
+	require.True(t, sources["a.png"].CollectedAt.Equal(documents[0].Dependencies[0].CollectedAt))
+}
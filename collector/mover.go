@@ -13,11 +13,14 @@ func LocalMover(cf collectable.FileOperator, base, objectKey string) error {
 	return cf.To(filepath.Join(base, objectKey))
 }
 
-// GetOBSMover Return a OBSMover which make files to OBS with specified object key
+// GetOBSMover Return a OBSMover which make files to OBS with specified object
+// key. The sha256 of the content is recorded in the metadata of the object, so
+// that the freshness is validated by the content
 func GetOBSMover(bucket provider.Bucket) (Mover, error) {
 	if bucket == nil {
 		return nil, errors.New("bucket should not be nil")
 	}
+	bucket = provider.NewChecksumBucket(bucket)
 	return func(cf collectable.FileOperator, base, objectKey string) error {
 		return cf.ToOBS(bucket, objectKey)
 	}, nil
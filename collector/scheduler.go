@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// Scheduler Limits the number of collecting jobs doing I/O at the same time.
+// Local I/O, such as reading and writing local files, and remote I/O, such as
+// uploading to obs, are limited separately. A nil Scheduler does not limit
+// anything
+type Scheduler struct {
+	local  chan struct{}
+	remote chan struct{}
+}
+
+// NewScheduler Create a Scheduler which allows localJobs jobs doing local I/O
+// and remoteJobs jobs doing remote I/O at the same time. Non-positive limits
+// mean no limit
+func NewScheduler(localJobs, remoteJobs int) *Scheduler {
+	return &Scheduler{
+		local:  newSemaphore(localJobs),
+		remote: newSemaphore(remoteJobs),
+	}
+}
+
+func newSemaphore(size int) chan struct{} {
+	if size <= 0 {
+		return nil
+	}
+	return make(chan struct{}, size)
+}
+
+// Local Run the job doing local I/O once a slot is free
+func (s *Scheduler) Local(ctx context.Context, job func() error) error {
+	if s == nil {
+		return job()
+	}
+	return run(ctx, s.local, job)
+}
+
+// Remote Run the job doing remote I/O once a slot is free
+func (s *Scheduler) Remote(ctx context.Context, job func() error) error {
+	if s == nil {
+		return job()
+	}
+	return run(ctx, s.remote, job)
+}
+
+func run(ctx context.Context, semaphore chan struct{}, job func() error) error {
+	if semaphore == nil {
+		return job()
+	}
+	select {
+	case semaphore <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-semaphore }()
+	return job()
+}
+
+// Merge Returns a channel which receives the results of all the completes, in
+// the order they complete. The channel is closed once all of them complete
+func Merge(completes ...<-chan error) <-chan error {
+	merged := make(chan error, len(completes))
+	wg := sync.WaitGroup{}
+	wg.Add(len(completes))
+	for _, complete := range completes {
+		go func(complete <-chan error) {
+			defer wg.Done()
+			merged <- <-complete
+		}(complete)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
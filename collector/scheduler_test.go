@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slipfre/imgmd/collectable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	scheduler := NewScheduler(2, 1)
+
+	mutex := sync.Mutex{}
+	running, maxRunning := 0, 0
+	job := func() error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return nil
+	}
+
+	completes := make([]<-chan error, 10)
+	for i := range completes {
+		complete := make(chan error, 1)
+		go func() { complete <- scheduler.Local(context.Background(), job) }()
+		completes[i] = complete
+	}
+	count := 0
+	for err := range Merge(completes...) {
+		require.Nil(t, err)
+		count++
+	}
+	require.Equal(t, 10, count)
+	require.Equal(t, 2, maxRunning)
+
+	// Jobs waiting for a slot give up once the context is done
+	hold := make(chan struct{})
+	go scheduler.Remote(context.Background(), func() error {
+		<-hold
+		return nil
+	})
+	time.Sleep(5 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := scheduler.Remote(ctx, func() error { return errors.New("should not run") })
+	require.Equal(t, context.Canceled, err)
+	close(hold)
+
+	// A nil scheduler does not limit anything
+	var unlimited *Scheduler
+	require.Nil(t, unlimited.Local(context.Background(), job))
+}
+
+func TestAsyncCollector_testCollectWithScheduler(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	files := map[string]string{
+		"doc.md":           "<link rel=\"stylesheet\" href=\"style.css\">\n\n![a](a.png) ![b](b.png)\n",
+		"style.css":        "p { background: url(bg.png); }\n",
+		"bg.png":           "bg",
+		"a.png":            "a",
+		"b.png":            "b",
+		"other/doc.md":     "![c](c.png)\n",
+		"other/c.png":      "c",
+		"other/unused.png": "unused",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0777))
+		require.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+	}
+
+	// Collectors waiting for their dependencies do not hold the only slot
+	scheduler := NewScheduler(1, 1)
+	completes := make([]<-chan error, 0)
+	for _, key := range []string{"doc.md", filepath.Join("other", "doc.md")} {
+		md := collectable.NewMarkdownFile("", filepath.Join(src, key))
+		require.Nil(t, md.FileError())
+		mdCollector, err := LocalCollectorGenerator(md, dest, key, LocalCollectorGenerator, WithScheduler(scheduler))
+		require.Nil(t, err)
+		completes = append(completes, mdCollector.Collect(context.Background()))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for err := range Merge(completes...) {
+			require.Nil(t, err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collecting with a scheduler of one slot does not complete")
+	}
+
+	require.FileExists(t, filepath.Join(dest, "doc_medias", "style_medias", "bg.png"))
+	require.FileExists(t, filepath.Join(dest, "doc_medias", "a.png"))
+	require.FileExists(t, filepath.Join(dest, "doc_medias", "b.png"))
+	require.FileExists(t, filepath.Join(dest, "other", "doc_medias", "c.png"))
+}
+
+func TestAsyncCollector_testCollectRemoteOnRemoteSlots(t *testing.T) {
+	mutex := sync.Mutex{}
+	running, maxRunning := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	src := t.TempDir()
+	dest := t.TempDir()
+	keys := []string{"a.md", "b.md", "c.md", "d.md"}
+	for _, key := range keys {
+		content := fmt.Sprintf("![1](%s/%s/1.png) ![2](%s/%s/2.png)\n", server.URL, key, server.URL, key)
+		require.Nil(t, ioutil.WriteFile(filepath.Join(src, key), []byte(content), 0666))
+	}
+
+	// Downloading the remote dependencies takes the remote slots, not the
+	// local ones
+	scheduler := NewScheduler(len(keys), 1)
+	completes := make([]<-chan error, 0)
+	for _, key := range keys {
+		md := collectable.NewMarkdownFile("", filepath.Join(src, key), collectable.WithRemotePolicy(collectable.RemoteMirror))
+		mdCollector, err := LocalCollectorGenerator(md, dest, key, LocalCollectorGenerator, WithScheduler(scheduler))
+		require.Nil(t, err)
+		completes = append(completes, mdCollector.Collect(context.Background()))
+	}
+	for err := range Merge(completes...) {
+		require.Nil(t, err)
+	}
+	require.Equal(t, 1, maxRunning)
+	for _, key := range keys {
+		require.FileExists(t, filepath.Join(dest, strings.TrimSuffix(key, ".md")+"_medias", "1.png"))
+	}
+}
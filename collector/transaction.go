@@ -0,0 +1,288 @@
+package collector
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/slipfre/imgmd/provider"
+)
+
+// Snapshot Prepares for collecting a file to base/objectKey. undo reverts the
+// target to what it was before the file is collected, and done releases what
+// is kept for undo once the collection is committed
+type Snapshot func(base, objectKey string) (undo func() error, done func(), err error)
+
+// LocalSnapshot Snapshot of the local files, which keeps a copy of the file
+// being overwritten beside it, and removes the file if it did not exist, along
+// with the directories created for it
+func LocalSnapshot(base, objectKey string) (undo func() error, done func(), err error) {
+	path := filepath.Join(base, objectKey)
+	source, err := os.Open(path)
+	if os.IsNotExist(err) {
+		created := missingDirs(filepath.Dir(path))
+		return func() error {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			// The directories are removed from the deepest one, and are kept
+			// if other files are collected into them
+			for _, dir := range created {
+				os.Remove(dir)
+			}
+			return nil
+		}, func() {}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer source.Close()
+
+	backup, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.bak")
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = io.Copy(backup, source)
+	if closeErr := backup.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(backup.Name())
+		return nil, nil, err
+	}
+	return func() error {
+			return os.Rename(backup.Name(), path)
+		}, func() {
+			os.Remove(backup.Name())
+		}, nil
+}
+
+// missingDirs Returns dir and its ancestors which do not exist, from the
+// deepest one
+func missingDirs(dir string) []string {
+	missing := make([]string, 0)
+	for {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			return missing
+		}
+		missing = append(missing, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return missing
+		}
+		dir = parent
+	}
+}
+
+// GetOBSSnapshot Returns a Snapshot of the objects in the bucket, which deletes
+// the objects created by the collection. The objects overwritten by the
+// collection can not be restored, since their previous contents are not kept
+func GetOBSSnapshot(bucket provider.Bucket) Snapshot {
+	return func(base, objectKey string) (undo func() error, done func(), err error) {
+		key := filepath.ToSlash(objectKey)
+		digest, err := bucket.GetObjectDigest(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if digest != nil {
+			return nil, func() {}, nil
+		}
+		return func() error {
+			return bucket.DeleteObject(key)
+		}, func() {}, nil
+	}
+}
+
+// Journal Journals the files created by the transactions of a run. A file
+// shared by several documents is undone only if all the transactions using it
+// are rolled back
+type Journal struct {
+	mutex   sync.Mutex
+	entries map[string]*journalEntry
+}
+
+// journalEntry The undo of a target and the transactions using it
+type journalEntry struct {
+	undo      func() error
+	done      func()
+	created   bool
+	committed bool
+	users     map[*Transaction]struct{}
+}
+
+// NewJournal Constructor for Journal
+func NewJournal() *Journal {
+	return &Journal{entries: make(map[string]*journalEntry)}
+}
+
+// Begin Begin a transaction for collecting a document
+func (j *Journal) Begin() *Transaction {
+	return &Transaction{journal: j}
+}
+
+// entry Returns the entry of target, the caller should hold the mutex
+func (j *Journal) entry(target string) *journalEntry {
+	entry, ok := j.entries[target]
+	if !ok {
+		entry = &journalEntry{users: make(map[*Transaction]struct{})}
+		j.entries[target] = entry
+	}
+	return entry
+}
+
+// share Begin a transaction shared by the transactions joining it, whose
+// files are journaled in each of them rather than in itself
+func (j *Journal) share() *Transaction {
+	return &Transaction{journal: j, shared: true}
+}
+
+// Transaction Files collected for a document, which are kept together once the
+// document is collected, or undone together if it fails
+type Transaction struct {
+	journal    *Journal
+	targets    []string
+	rolledBack bool
+	shared     bool
+	members    []*Transaction
+}
+
+// Use Mark target as used by the transaction, before it is collected
+func (tx *Transaction) Use(target string) {
+	tx.journal.mutex.Lock()
+	defer tx.journal.mutex.Unlock()
+	tx.journalTarget(target)
+}
+
+// journalTarget Mark target as used by the transaction, or by every member if
+// it is shared. The caller should hold the mutex
+func (tx *Transaction) journalTarget(target string) {
+	if !tx.shared {
+		if !tx.rolledBack {
+			tx.journal.entry(target).users[tx] = struct{}{}
+			tx.targets = append(tx.targets, target)
+		}
+		return
+	}
+	tx.targets = append(tx.targets, target)
+	for _, member := range tx.members {
+		member.journalTarget(target)
+	}
+}
+
+// users Returns the transactions using the files journaled in the transaction,
+// which are the members not rolled back if it is shared. The caller should
+// hold the mutex
+func (tx *Transaction) users() []*Transaction {
+	if !tx.shared {
+		if tx.rolledBack {
+			return nil
+		}
+		return []*Transaction{tx}
+	}
+	users := make([]*Transaction, 0, len(tx.members))
+	for _, member := range tx.members {
+		users = append(users, member.users()...)
+	}
+	return users
+}
+
+// join Make member use the files journaled in the shared transaction, both the
+// ones journaled and the ones to be. It fails if all the members have been
+// rolled back, since the files may have been undone
+func (tx *Transaction) join(member *Transaction) bool {
+	tx.journal.mutex.Lock()
+	defer tx.journal.mutex.Unlock()
+	if len(tx.members) > 0 && len(tx.users()) == 0 {
+		return false
+	}
+	tx.members = append(tx.members, member)
+	for _, target := range tx.targets {
+		member.journalTarget(target)
+	}
+	return true
+}
+
+// Created Journal that target is created, with the undo and done returned by
+// the Snapshot. If the transaction has been rolled back, or all the members
+// of the shared one, and no one else uses target, it is undone at once
+func (tx *Transaction) Created(target string, undo func() error, done func()) error {
+	tx.journal.mutex.Lock()
+	defer tx.journal.mutex.Unlock()
+	entry := tx.journal.entry(target)
+	if entry.created {
+		// The first snapshot holds what the target was before the run
+		if done != nil {
+			done()
+		}
+		return nil
+	}
+	entry.undo, entry.done, entry.created = undo, done, true
+	if entry.committed {
+		tx.journal.release(entry)
+		return nil
+	}
+	tx.journalTarget(target)
+	if len(tx.users()) > 0 {
+		return nil
+	}
+	if len(entry.users) == 0 {
+		delete(tx.journal.entries, target)
+		if entry.undo != nil {
+			return entry.undo()
+		}
+	}
+	return nil
+}
+
+// Commit Keep the files of the transaction
+func (tx *Transaction) Commit() {
+	tx.journal.mutex.Lock()
+	defer tx.journal.mutex.Unlock()
+	for _, target := range tx.targets {
+		entry := tx.journal.entry(target)
+		entry.committed = true
+		tx.journal.release(entry)
+	}
+	tx.targets = nil
+}
+
+// Rollback Undo the files created by the transaction in reverse order, except
+// the ones used by other transactions. Files created after the rollback are
+// undone once they are journaled
+func (tx *Transaction) Rollback() error {
+	tx.journal.mutex.Lock()
+	defer tx.journal.mutex.Unlock()
+	tx.rolledBack = true
+	var err error
+	for i := len(tx.targets) - 1; i >= 0; i-- {
+		target := tx.targets[i]
+		entry, ok := tx.journal.entries[target]
+		if !ok {
+			continue
+		}
+		delete(entry.users, tx)
+		if entry.committed || len(entry.users) > 0 || !entry.created {
+			continue
+		}
+		delete(tx.journal.entries, target)
+		if entry.undo == nil {
+			continue
+		}
+		if undoErr := entry.undo(); undoErr != nil && err == nil {
+			err = undoErr
+		}
+	}
+	tx.targets = nil
+	return err
+}
+
+// release Release what is kept for undoing the entry, the caller should hold
+// the mutex
+func (j *Journal) release(entry *journalEntry) {
+	if entry.created && entry.done != nil {
+		entry.done()
+		entry.done = nil
+	}
+}
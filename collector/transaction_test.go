@@ -0,0 +1,172 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/slipfre/imgmd/collectable"
+	"github.com/slipfre/imgmd/provider"
+	"github.com/stretchr/testify/require"
+)
+
+// failingBucket A memoryBucket failing to put the object with the key
+type failingBucket struct {
+	*memoryBucket
+	key string
+}
+
+func (b *failingBucket) PutObjectFromFile(objectKey, filePath string, options ...provider.ObjectOption) (string, error) {
+	if objectKey == b.key {
+		return "", errors.New("failed to put " + objectKey)
+	}
+	return b.memoryBucket.PutObjectFromFile(objectKey, filePath, options...)
+}
+
+func (b *failingBucket) PutObjectFromBytes(objectKey string, data []byte, options ...provider.ObjectOption) (string, error) {
+	if objectKey == b.key {
+		return "", errors.New("failed to put " + objectKey)
+	}
+	return b.memoryBucket.PutObjectFromBytes(objectKey, data, options...)
+}
+
+func (b *failingBucket) PutObject(objectKey string, reader io.Reader, options ...provider.ObjectOption) (string, error) {
+	if objectKey == b.key {
+		return "", errors.New("failed to put " + objectKey)
+	}
+	return b.memoryBucket.PutObject(objectKey, reader, options...)
+}
+
+func TestAsyncCollector_testCollectWithJournal(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	for _, name := range []string{"a.png", "b.png", "c.png", "d.png", "e.png"} {
+		writeTestFile(t, filepath.Join(src, name), name)
+	}
+	writeTestFile(t, filepath.Join(src, "doc.md"), "![a](a.png) ![b](b.png) ![c](c.png) ![d](d.png) ![e](e.png)\n")
+	writeTestFile(t, filepath.Join(dest, "doc.md"), "old doc")
+	writeTestFile(t, filepath.Join(dest, "doc_medias", "b.png"), "old b")
+	bucket := &failingBucket{memoryBucket: newMemoryBucket(), key: "doc_medias/c.png"}
+	_, err := bucket.PutObjectFromBytes("doc_medias/e.png", []byte("old e"))
+	require.Nil(t, err)
+
+	// a.png and b.png are collected to local, and the others to the bucket
+	generator := func(cf collectable.FileOperator, base, objectKey string, depGenerator Generator, options ...Option) (Collector, error) {
+		switch filepath.Base(cf.GetURI()) {
+		case "a.png", "b.png":
+			return LocalCollectorGenerator(cf, base, objectKey, depGenerator, options...)
+		}
+		return GetOBSCollectorGenerator(bucket)(cf, base, objectKey, depGenerator, options...)
+	}
+	collect := func() error {
+		md := collectable.NewMarkdownFile("", filepath.Join(src, "doc.md"))
+		collector, err := GetLocalCollectorGenerator(collectable.LocalMapperFactory)(
+			md, dest, "doc.md", generator, WithForce(true), WithJournal(NewJournal()))
+		require.Nil(t, err)
+		return <-collector.Collect(context.Background())
+	}
+
+	require.NotNil(t, collect())
+	require.Equal(t, "old doc", readTestFile(t, filepath.Join(dest, "doc.md")))
+	require.Equal(t, "old b", readTestFile(t, filepath.Join(dest, "doc_medias", "b.png")))
+	require.NoFileExists(t, filepath.Join(dest, "doc_medias", "a.png"))
+	files, err := ioutil.ReadDir(filepath.Join(dest, "doc_medias"))
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	// The objects created are deleted, while the overwritten ones are kept
+	require.Len(t, bucket.objects, 1)
+	require.Contains(t, bucket.objects, "doc_medias/e.png")
+
+	bucket.key = ""
+	require.Nil(t, collect())
+	require.Equal(t, "b.png", readTestFile(t, filepath.Join(dest, "doc_medias", "b.png")))
+	require.FileExists(t, filepath.Join(dest, "doc_medias", "a.png"))
+	files, err = ioutil.ReadDir(filepath.Join(dest, "doc_medias"))
+	require.Nil(t, err)
+	require.Len(t, files, 2)
+	require.Len(t, bucket.objects, 3)
+}
+
+func TestTransaction(t *testing.T) {
+	journal := NewJournal()
+	undone := make(map[string]int)
+	done := make(map[string]int)
+	created := func(tx *Transaction, target string) {
+		require.Nil(t, tx.Created(target, func() error {
+			undone[target]++
+			return nil
+		}, func() {
+			done[target]++
+		}))
+	}
+
+	// The shared target is undone once all the transactions using it are
+	// rolled back
+	tx1, tx2 := journal.Begin(), journal.Begin()
+	tx1.Use("shared")
+	tx2.Use("shared")
+	created(tx1, "shared")
+	created(tx2, "own")
+	require.Nil(t, tx1.Rollback())
+	require.Zero(t, undone["shared"])
+	require.Nil(t, tx2.Rollback())
+	require.Equal(t, 1, undone["shared"])
+	require.Equal(t, 1, undone["own"])
+
+	// The target created after the rollback is undone at once
+	tx3 := journal.Begin()
+	tx3.Use("late")
+	require.Nil(t, tx3.Rollback())
+	created(tx3, "late")
+	require.Equal(t, 1, undone["late"])
+
+	// The committed target is kept
+	tx4, tx5 := journal.Begin(), journal.Begin()
+	tx4.Use("kept")
+	tx5.Use("kept")
+	created(tx4, "kept")
+	tx4.Commit()
+	require.Equal(t, 1, done["kept"])
+	require.Nil(t, tx5.Rollback())
+	require.Zero(t, undone["kept"])
+}
+
+func TestLocalSnapshot(t *testing.T) {
+	base := t.TempDir()
+	writeTestFile(t, filepath.Join(base, "images", "kept.png"), "kept")
+
+	// The nested directories created for the file are removed, and the ones
+	// existing before are kept
+	undo, _, err := LocalSnapshot(base, filepath.Join("images", "2026", "10", "new.png"))
+	require.Nil(t, err)
+	writeTestFile(t, filepath.Join(base, "images", "2026", "10", "new.png"), "new")
+	require.Nil(t, undo())
+	require.NoDirExists(t, filepath.Join(base, "images", "2026"))
+	require.FileExists(t, filepath.Join(base, "images", "kept.png"))
+
+	// An existing empty directory is not removed
+	require.Nil(t, os.MkdirAll(filepath.Join(base, "empty"), 0777))
+	undo, _, err = LocalSnapshot(base, filepath.Join("empty", "new.png"))
+	require.Nil(t, err)
+	writeTestFile(t, filepath.Join(base, "empty", "new.png"), "new")
+	require.Nil(t, undo())
+	require.DirExists(t, filepath.Join(base, "empty"))
+	require.NoFileExists(t, filepath.Join(base, "empty", "new.png"))
+}
+
+// writeTestFile Write content to the file at path, creating its directory
+func writeTestFile(t *testing.T, path, content string) {
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0777))
+	require.Nil(t, ioutil.WriteFile(path, []byte(content), 0666))
+}
+
+// readTestFile Returns the content of the file at path
+func readTestFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	return string(data)
+}
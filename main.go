@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/slipfre/imgmd/cmd"
 	"github.com/slipfre/imgmd/collectable"
@@ -13,7 +14,7 @@ var typeFlag = &cli.StringSliceFlag{
 	Name:    "type",
 	Aliases: []string{"t"},
 	Value:   cli.NewStringSlice(string(collectable.Markdown)),
-	Usage:   "Types of file you want to collect",
+	Usage:   "Types of file you want to collect, which are " + documentTypes(),
 }
 
 var recursiveFlag = &cli.BoolFlag{
@@ -37,6 +38,142 @@ var dep2obsFlag = &cli.StringSliceFlag{
 	Usage:   "Types of dependency files which want to put in obs",
 }
 
+var extractEmbeddedFlag = &cli.BoolFlag{
+	Name:    "extract-embedded",
+	Aliases: []string{"x"},
+	Value:   false,
+	Usage:   "Extract images embedded in files, such as data uris and attachments and outputs of notebooks, to standalone files",
+}
+
+var frontMatterKeyFlag = &cli.StringSliceFlag{
+	Name:  "front-matter-key",
+	Value: cli.NewStringSlice(collectable.DefaultFrontMatterKeys...),
+	Usage: "Keys of markdown front matter whose values are paths of dependencies, such as cover, image and images",
+}
+
+var remoteFlag = &cli.StringFlag{
+	Name:  "remote",
+	Value: string(collectable.RemoteKeep),
+	Usage: "How to collect dependencies referred by http or https urls, 'mirror' downloads and collects them, 'keep' leaves the urls untouched",
+}
+
+var inlineFlag = &cli.BoolFlag{
+	Name:  "inline",
+	Value: false,
+	Usage: "Embed dependencies into the collected files as base64 data uris instead of collecting them, including the ones referred by http or https urls, which are downloaded regardless of '--remote'",
+}
+
+var inlineMaxSizeFlag = &cli.Int64Flag{
+	Name:  "inline-max-size",
+	Value: 1 << 20,
+	Usage: "Max size in bytes of dependencies to embed with '--inline', larger ones are collected as usual. Non-positive for no limit",
+}
+
+var jobsFlag = &cli.IntFlag{
+	Name:    "jobs",
+	Aliases: []string{"j"},
+	Value:   16,
+	Usage:   "Max number of files read or written locally at the same time. Non-positive for no limit",
+}
+
+var remoteJobsFlag = &cli.IntFlag{
+	Name:  "remote-jobs",
+	Value: 4,
+	Usage: "Max number of files downloaded, checked or uploaded to obs at the same time. Non-positive for no limit",
+}
+
+var dedupeFlag = &cli.BoolFlag{
+	Name:  "dedupe",
+	Usage: "Store dependencies by the hashes of their contents, so that identical ones are stored once under '--dedupe-dir'. Overrides the key templates of the config file",
+}
+
+var dedupeDirFlag = &cli.StringFlag{
+	Name:  "dedupe-dir",
+	Value: "_medias",
+	Usage: "Directory or key prefix, relative to the destination, of the dependencies stored with '--dedupe'",
+}
+
+var layoutFlag = &cli.StringFlag{
+	Name:  "layout",
+	Value: "flat",
+	Usage: "Layout of the collected dependencies: 'flat' puts them right under the media directory, 'preserve' keeps their paths relative to the document or '--layout-root'. Ignored with '--dedupe', overrides the key templates of the config file",
+}
+
+var layoutRootFlag = &cli.PathFlag{
+	Name:  "layout-root",
+	Usage: "Root directory whose layout is kept with '--layout preserve', default to the directory of each document",
+}
+
+var keyTemplateFlag = &cli.StringFlag{
+	Name:  "key-template",
+	Usage: "Template of the paths or object keys of dependencies, such as 'images/{yyyy}/{mm}/{sha256:12}{ext}' or '{docKey}/{basename}'. Variables: docKey, medias, basename, name, ext, sha256[:N], yyyy, mm, dd, type. Overrides 'LOCAL.KEY_TEMPLATE' and 'OBS.KEY_TEMPLATE' of the config file, '--layout' and '--dedupe'",
+}
+
+var manifestFlag = &cli.BoolFlag{
+	Name:  "manifest",
+	Usage: "Record the copied documents in '.cres/manifest.json' of the destination, which 'collect' does for the repository by default",
+}
+
+var noManifestFlag = &cli.BoolFlag{
+	Name:  "no-manifest",
+	Usage: "Do not record the collected documents in '.cres/manifest.json' of the repository",
+}
+
+var atomicFlag = &cli.BoolFlag{
+	Name:  "atomic",
+	Usage: "Collect each document all or nothing: if any of its dependencies fails, the files and objects created for it are removed and the overwritten local files are restored",
+}
+
+var keepGoingFlag = &cli.BoolFlag{
+	Name:  "keep-going",
+	Usage: "Attempt all the dependencies even though some of them fail, and report the errors grouped by document at the end",
+}
+
+var progressFlag = &cli.BoolFlag{
+	Name:  "progress",
+	Usage: "Show the progress of the documents and the uploading files, with the throughput",
+}
+
+var reportFlag = &cli.StringFlag{
+	Name:  "report",
+	Usage: "Write a report of what the run did to each document and its dependencies in place of the summary log, 'json' or 'junit'",
+}
+
+var reportFileFlag = &cli.PathFlag{
+	Name:  "report-file",
+	Usage: "File the report is written to, default to the standard output",
+}
+
+var resumeFlag = &cli.BoolFlag{
+	Name:  "resume",
+	Usage: "Collect only the documents left by the run interrupted by SIGINT or SIGTERM, which are saved in '.cres/resume.json' of the repository or the destination",
+}
+
+var retriesFlag = &cli.IntFlag{
+	Name:  "retries",
+	Value: 2,
+	Usage: "Max number of retries after transient failures of downloading and uploading",
+}
+
+var rpsFlag = &cli.Float64Flag{
+	Name:  "rps",
+	Usage: "Max number of requests per second to obs and http servers, 0 for no limit. Overrides 'LIMITS.RPS' of the config file",
+}
+
+var bandwidthFlag = &cli.StringFlag{
+	Name:  "bandwidth",
+	Usage: "Max bytes per second uploaded to obs and downloaded from http servers, such as 512K and 2M. Overrides 'LIMITS.BANDWIDTH' of the config file",
+}
+
+// documentTypes Returns the registered document types separated by commas
+func documentTypes() string {
+	types := make([]string, 0)
+	for _, fileType := range collectable.DocumentTypes() {
+		types = append(types, string(fileType))
+	}
+	return strings.Join(types, ", ")
+}
+
 func main() {
 	app := &cli.App{
 		Name:  "cres",
@@ -46,6 +183,29 @@ func main() {
 			recursiveFlag,
 			configFlag,
 			dep2obsFlag,
+			extractEmbeddedFlag,
+			frontMatterKeyFlag,
+			remoteFlag,
+			inlineFlag,
+			inlineMaxSizeFlag,
+			jobsFlag,
+			remoteJobsFlag,
+			dedupeFlag,
+			dedupeDirFlag,
+			layoutFlag,
+			layoutRootFlag,
+			keyTemplateFlag,
+			manifestFlag,
+			noManifestFlag,
+			atomicFlag,
+			keepGoingFlag,
+			progressFlag,
+			reportFlag,
+			reportFileFlag,
+			resumeFlag,
+			retriesFlag,
+			rpsFlag,
+			bandwidthFlag,
 		},
 		Commands: []*cli.Command{
 			cmd.MoveCommand,
@@ -0,0 +1,299 @@
+package manifest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+const (
+	// Dir The directory of the manifest under the repository
+	Dir = ".cres"
+	// FileName The file name of the manifest
+	FileName = "manifest.json"
+	// Version The version of the manifest format
+	Version = 1
+	// SaveInterval The min interval between the saves of the manifest while
+	// documents are committed, the manifest is saved at the end of the run
+	// anyway
+	SaveInterval = 10 * time.Second
+)
+
+// Location Where a file is stored, a local path or an object in a bucket
+type Location struct {
+	Path   string `json:"path,omitempty"`
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// Dependency A dependency collected along with a document
+type Dependency struct {
+	Source string `json:"source"`
+	// Referrer is the source of the file referring to the dependency, which
+	// is the document or another dependency
+	Referrer    string    `json:"referrer"`
+	SHA256      string    `json:"sha256"`
+	Location    Location  `json:"location"`
+	CollectedAt time.Time `json:"collectedAt"`
+}
+
+// Document A collected document and all of its dependencies
+type Document struct {
+	Source       string       `json:"source"`
+	Key          string       `json:"key"`
+	SHA256       string       `json:"sha256"`
+	Location     Location     `json:"location"`
+	CollectedAt  time.Time    `json:"collectedAt"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// Object A file collected in the run, recorded by its collector
+type Object struct {
+	Source   string
+	SHA256   string
+	Location Location
+	// Dependencies are the targets of the dependencies of the file
+	Dependencies []string
+	// Fresh is true if the file was up to date and not collected again
+	Fresh bool
+}
+
+// Manifest Records every document collected into the repository, kept in
+// 'root/.cres/manifest.json'. Collectors record the files they collect, and the
+// record of a document is replaced once it and all its dependencies are
+// collected, so the manifest never records half collected documents. The
+// sources and local paths are recorded relative to root, so the repository can
+// be moved. The committed records are saved every SaveInterval, and Save should
+// be called at the end of the run
+type Manifest struct {
+	root      string
+	path      string
+	mutex     sync.Mutex
+	documents map[string]*Document
+	// objects are the files collected in the run, by their targets
+	objects map[string]*object
+	// saving is held while the manifest is written, so that the saves do not
+	// overwrite newer ones
+	saving sync.Mutex
+	// dirty is true if there are records committed but not saved
+	dirty bool
+	saved time.Time
+}
+
+type object struct {
+	Object
+	collectedAt time.Time
+}
+
+type manifestFile struct {
+	Version   int                  `json:"version"`
+	Documents map[string]*Document `json:"documents"`
+}
+
+// Open Open the manifest of the repository at root, which is empty if it does
+// not exist yet
+func Open(root string) (*Manifest, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		root:      root,
+		path:      filepath.Join(root, Dir, FileName),
+		documents: make(map[string]*Document),
+		objects:   make(map[string]*object),
+		saved:     time.Now(),
+	}
+	data, err := ioutil.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file := manifestFile{}
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Documents != nil {
+		m.documents = file.Documents
+	}
+	return m, nil
+}
+
+// Path Returns the path of the manifest file
+func (m *Manifest) Path() string {
+	return m.path
+}
+
+// Record Record the file collected to target in the run
+func (m *Manifest) Record(target string, o Object) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.objects[target] = &object{Object: o, collectedAt: time.Now()}
+}
+
+// Commit Replace the record of the document collected to target with the
+// files recorded in the run, and save the manifest if it was not saved in
+// SaveInterval
+func (m *Manifest) Commit(target string) error {
+	m.mutex.Lock()
+	if !m.commit(target) || time.Since(m.saved) < SaveInterval {
+		m.mutex.Unlock()
+		return nil
+	}
+	m.mutex.Unlock()
+	return m.Save()
+}
+
+// commit Replace the record of the document, returns false if the document is
+// not recorded. The caller should hold the mutex
+func (m *Manifest) commit(target string) bool {
+	root, ok := m.objects[target]
+	if !ok {
+		return false
+	}
+	key := m.key(target)
+	previous := m.documents[key]
+	document := &Document{
+		Source:       m.relative(root.Source),
+		Key:          key,
+		SHA256:       root.SHA256,
+		Location:     m.location(root.Location),
+		CollectedAt:  root.collectedAt,
+		Dependencies: make([]Dependency, 0),
+	}
+	if root.Fresh && previous != nil && previous.SHA256 == root.SHA256 {
+		document.CollectedAt = previous.CollectedAt
+	}
+
+	visited := map[string]struct{}{target: {}}
+	var walk func(referrer *object)
+	walk = func(referrer *object) {
+		for _, depTarget := range referrer.Dependencies {
+			if _, ok := visited[depTarget]; ok {
+				continue
+			}
+			visited[depTarget] = struct{}{}
+			dep, ok := m.objects[depTarget]
+			if !ok {
+				// Dependencies embedded into the referrer are not collected
+				continue
+			}
+			dependency := Dependency{
+				Source:      m.relative(dep.Source),
+				Referrer:    m.relative(referrer.Source),
+				SHA256:      dep.SHA256,
+				Location:    m.location(dep.Location),
+				CollectedAt: dep.collectedAt,
+			}
+			if dep.Fresh {
+				dependency.CollectedAt = previousCollectedAt(previous, dependency)
+			}
+			document.Dependencies = append(document.Dependencies, dependency)
+			walk(dep)
+		}
+	}
+	walk(root)
+
+	m.documents[key] = document
+	m.dirty = true
+	return true
+}
+
+// Save Write the committed records if they are not saved yet
+func (m *Manifest) Save() error {
+	m.saving.Lock()
+	defer m.saving.Unlock()
+
+	m.mutex.Lock()
+	if !m.dirty {
+		m.mutex.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(manifestFile{Version: Version, Documents: m.documents}, "", "  ")
+	if err == nil {
+		m.dirty = false
+		m.saved = time.Now()
+	}
+	m.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = utils.WriteFileAtomic(m.path, data, 0666); err != nil {
+		m.mutex.Lock()
+		m.dirty = true
+		m.mutex.Unlock()
+	}
+	return err
+}
+
+// Documents Returns the records of all the documents, sorted by their keys
+func (m *Manifest) Documents() []Document {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	documents := make([]Document, 0, len(m.documents))
+	for _, document := range m.documents {
+		documents = append(documents, *document)
+	}
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].Key < documents[j].Key
+	})
+	return documents
+}
+
+// key Returns the key of the target relative to the repository
+func (m *Manifest) key(target string) string {
+	if abs, err := filepath.Abs(target); err == nil {
+		target = abs
+	}
+	rel, err := filepath.Rel(m.root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(target)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// relative Returns the local path relative to the repository, remote uris are
+// kept as they are
+func (m *Manifest) relative(path string) string {
+	if path == "" || utils.IsHTTPURI(path) {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	rel, err := filepath.Rel(m.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// location Returns the location with the local path relative to the repository
+func (m *Manifest) location(location Location) Location {
+	location.Path = m.relative(location.Path)
+	return location
+}
+
+// previousCollectedAt Returns the time the fresh dependency was collected,
+// which is recorded by the previous record of the document, or now if unknown
+func previousCollectedAt(previous *Document, dependency Dependency) time.Time {
+	if previous != nil {
+		for _, d := range previous.Dependencies {
+			if d.Location == dependency.Location && d.SHA256 == dependency.SHA256 {
+				return d.CollectedAt
+			}
+		}
+	}
+	return dependency.CollectedAt
+}
@@ -0,0 +1,60 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	root := t.TempDir()
+	m, err := Open(root)
+	require.Nil(t, err)
+	require.Empty(t, m.Documents())
+
+	doc := filepath.Join(root, "docs", "doc.md")
+	css := filepath.Join(root, "docs", "doc_medias", "style.css")
+	png := filepath.Join(root, "docs", "doc_medias", "style_medias", "bg.png")
+	embedded := filepath.Join(root, "docs", "doc_medias", "embedded.png")
+	m.Record(png, Object{Source: filepath.Join(root, "src", "bg.png"), SHA256: "png", Location: Location{Bucket: "b", Key: "bg.png", URL: "https://b/bg.png"}})
+	m.Record(css, Object{Source: filepath.Join(root, "src", "style.css"), SHA256: "css", Location: Location{Path: css}, Dependencies: []string{png}})
+	m.Record(doc, Object{Source: filepath.Join(root, "src", "doc.md"), SHA256: "doc", Location: Location{Path: doc}, Dependencies: []string{css, embedded}})
+
+	require.Nil(t, m.Commit(doc))
+	require.NoFileExists(t, m.Path())
+	require.Nil(t, m.Save())
+
+	reopened, err := Open(root)
+	require.Nil(t, err)
+	documents := reopened.Documents()
+	require.Len(t, documents, 1)
+	document := documents[0]
+	require.Equal(t, "docs/doc.md", document.Key)
+	require.Equal(t, "src/doc.md", document.Source)
+	require.Equal(t, "doc", document.SHA256)
+	require.Len(t, document.Dependencies, 2)
+	require.Equal(t, "src/style.css", document.Dependencies[0].Source)
+	require.Equal(t, "src/doc.md", document.Dependencies[0].Referrer)
+	require.Equal(t, "src/bg.png", document.Dependencies[1].Source)
+	require.Equal(t, "src/style.css", document.Dependencies[1].Referrer)
+	require.Equal(t, "https://b/bg.png", document.Dependencies[1].Location.URL)
+	require.Equal(t, "docs/doc.md", document.Location.Path)
+
+	// Fresh files keep the time they were collected
+	reopened.Record(png, Object{Source: filepath.Join(root, "src", "bg.png"), SHA256: "png", Location: Location{Bucket: "b", Key: "bg.png", URL: "https://b/bg.png"}, Fresh: true})
+	reopened.Record(css, Object{Source: filepath.Join(root, "src", "style.css"), SHA256: "changed", Location: Location{Path: css}, Dependencies: []string{png}})
+	reopened.Record(doc, Object{Source: filepath.Join(root, "src", "doc.md"), SHA256: "doc", Location: Location{Path: doc}, Dependencies: []string{css}, Fresh: true})
+	require.Nil(t, reopened.Commit(doc))
+	recommitted := reopened.Documents()[0]
+	require.Equal(t, document.CollectedAt, recommitted.CollectedAt)
+	require.Equal(t, document.Dependencies[1].CollectedAt, recommitted.Dependencies[1].CollectedAt)
+	require.Equal(t, "changed", recommitted.Dependencies[0].SHA256)
+
+	// No temporary files are left
+	files, err := ioutil.ReadDir(filepath.Join(root, Dir))
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, FileName, files[0].Name())
+}
@@ -5,11 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/slipfre/imgmd/provider"
+	"github.com/slipfre/imgmd/utils"
 )
 
 // Bucket Ali OSS Bucket 服务集成类
@@ -26,11 +29,12 @@ func NewBucket(bucket *oss.Bucket) *Bucket {
 
 // PutObjectFromFile 上传本地文件
 func (bucket *Bucket) PutObjectFromFile(objectKey, filePath string, options ...provider.ObjectOption) (url string, err error) {
-	if reader, err := os.Open(filePath); err == nil {
-		defer reader.Close()
-		return bucket.PutObject(objectKey, reader, options...)
+	reader, err := os.Open(filePath)
+	if err != nil {
+		return
 	}
-	return
+	defer reader.Close()
+	return bucket.PutObject(objectKey, reader, options...)
 }
 
 // PutObjectFromBytes 上传 byte 数组
@@ -56,14 +60,22 @@ func (bucket *Bucket) PutObject(objectKey string, reader io.Reader, options ...p
 	if err != nil {
 		return
 	}
-	err = bucket.aliBucket.PutObject(
-		objectKey,
-		reader,
+	aliOptions := []oss.Option{
 		oss.ObjectACL(aliACL),
 		oss.StorageClass(aliStorageClass),
 		oss.RedundancyType(aliRedundancyType),
-	)
+	}
+	for key, value := range objectConfig.Meta {
+		aliOptions = append(aliOptions, oss.Meta(key, value))
+	}
+	// The SDK only knows the length of some types of readers, wrapped readers
+	// are sent with their length given by the options
+	if _, err := oss.GetReaderLen(reader); err != nil && objectConfig.ContentLength >= 0 {
+		reader = &io.LimitedReader{R: reader, N: objectConfig.ContentLength}
+	}
+	err = bucket.aliBucket.PutObject(objectKey, reader, aliOptions...)
 	if err != nil {
+		err = toStatusError(err)
 		return
 	}
 	url = fmt.Sprintf(
@@ -77,7 +89,7 @@ func (bucket *Bucket) PutObject(objectKey string, reader io.Reader, options ...p
 
 // DeleteObject 删除 Object
 func (bucket *Bucket) DeleteObject(objectKey string) (err error) {
-	err = bucket.aliBucket.DeleteObject(objectKey)
+	err = toStatusError(bucket.aliBucket.DeleteObject(objectKey))
 	return
 }
 
@@ -85,7 +97,7 @@ func (bucket *Bucket) DeleteObject(objectKey string) (err error) {
 func (bucket *Bucket) GetObjectLastModified(objectKey string) (*time.Time, error) {
 	headers, err := bucket.aliBucket.GetObjectMeta(objectKey)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
 	}
 	lastModified := headers.Get("Last-Modified")
 	lastModifiedTime, err := time.ParseInLocation(time.RFC1123, lastModified, time.UTC)
@@ -95,6 +107,23 @@ func (bucket *Bucket) GetObjectLastModified(objectKey string) (*time.Time, error
 	return &lastModifiedTime, err
 }
 
+// GetObjectDigest 获取 Object 内容的摘要，Object 不存在时返回 nil
+func (bucket *Bucket) GetObjectDigest(objectKey string) (*provider.ObjectDigest, error) {
+	headers, err := bucket.aliBucket.GetObjectDetailedMeta(objectKey)
+	if err != nil {
+		var serviceError oss.ServiceError
+		if errors.As(err, &serviceError) && serviceError.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, toStatusError(err)
+	}
+	return &provider.ObjectDigest{
+		ETag:   strings.Trim(headers.Get(oss.HTTPHeaderEtag), "\""),
+		CRC64:  headers.Get(oss.HTTPHeaderOssCRC64),
+		SHA256: headers.Get(oss.HTTPHeaderOssMetaPrefix + provider.MetaSHA256),
+	}, nil
+}
+
 // GetObjectURL 获取 Object 的 URL
 func (bucket *Bucket) GetObjectURL(objectKey string) string {
 	return fmt.Sprintf(
@@ -105,12 +134,31 @@ func (bucket *Bucket) GetObjectURL(objectKey string) string {
 	)
 }
 
+// GetName 获取 Bucket 的名称
+func (bucket *Bucket) GetName() string {
+	return bucket.aliBucket.BucketName
+}
+
 // IsObjectExist 判断 Object 是否存在
 func (bucket *Bucket) IsObjectExist(objectKey string) (isExist bool, err error) {
 	isExist, err = bucket.aliBucket.IsObjectExist(objectKey)
+	err = toStatusError(err)
 	return
 }
 
+// toStatusError 把带有 HTTP 状态码的 OSS 错误转化为 utils.StatusError，以便判断是否可以重试
+func toStatusError(err error) error {
+	var serviceError oss.ServiceError
+	if errors.As(err, &serviceError) {
+		return &utils.StatusError{StatusCode: serviceError.StatusCode, Err: err}
+	}
+	var unexpectedError oss.UnexpectedStatusCodeError
+	if errors.As(err, &unexpectedError) {
+		return &utils.StatusError{StatusCode: unexpectedError.Got(), Err: err}
+	}
+	return err
+}
+
 // ToAliACL 把 provider.ACL 转化为 oss.ACLType
 func toAliACL(acl provider.ACL) (ossACL oss.ACLType, err error) {
 	switch acl {
@@ -1,15 +1,35 @@
 package provider
 
-import "time"
+import (
+	"io"
+	"os"
+	"time"
+)
 
 // Bucket OBS 服务供应商的 bucket 接口，用于提供对象存储功能
 type Bucket interface {
 	PutObjectFromFile(objectKey, filePath string, options ...ObjectOption) (url string, err error)
 	PutObjectFromBytes(objectKey string, data []byte, options ...ObjectOption) (url string, err error)
+	PutObject(objectKey string, reader io.Reader, options ...ObjectOption) (url string, err error)
 	DeleteObject(objectKey string) (err error)
 	IsObjectExist(objectKey string) (isExist bool, err error)
 	GetObjectLastModified(objectKey string) (*time.Time, error)
+	GetObjectDigest(objectKey string) (*ObjectDigest, error)
 	GetObjectURL(objectKey string) string
+	GetName() string
+}
+
+// MetaSHA256 记录 Object 内容 SHA-256 的元数据
+const MetaSHA256 = "sha256"
+
+// ObjectDigest Object 内容的摘要，供应商不提供的项为空。Object 不存在时为 nil
+type ObjectDigest struct {
+	// ETag 去掉引号的 ETag，简单上传的 Object 为内容的 MD5
+	ETag string
+	// CRC64 内容的 CRC64 (ECMA)，十进制表示
+	CRC64 string
+	// SHA256 上传时记录在元数据 MetaSHA256 中的内容的 SHA-256
+	SHA256 string
 }
 
 // ObjectOption Bucket 相关的可选参数
@@ -36,11 +56,32 @@ func WithRedundancyType(redundancyType DataRedundancyType) ObjectOption {
 	}
 }
 
+// WithMeta Object 的自定义元数据可选参数
+func WithMeta(key, value string) ObjectOption {
+	return func(config *OptionConfig) {
+		if config.Meta == nil {
+			config.Meta = make(map[string]string)
+		}
+		config.Meta[key] = value
+	}
+}
+
+// WithContentLength 上传的数据长度可选参数，reader 被包装后无法得知长度时，用于保留
+// Content-Length
+func WithContentLength(length int64) ObjectOption {
+	return func(config *OptionConfig) {
+		config.ContentLength = length
+	}
+}
+
 // OptionConfig Object 相关的配置参数
 type OptionConfig struct {
 	ACL            ACL
 	Storage        Storage
 	RedundancyType DataRedundancyType
+	Meta           map[string]string
+	// ContentLength 上传的数据长度，-1 表示未知
+	ContentLength int64
 }
 
 // DefaultOptionConfig 获取 Object 的默认配置
@@ -49,10 +90,30 @@ func DefaultOptionConfig() (config *OptionConfig) {
 		ACL:            PublicRead,
 		Storage:        Standard,
 		RedundancyType: LRS,
+		ContentLength:  -1,
 	}
 	return
 }
 
+// readerLen 返回 reader 中未读取的数据长度，无法得知时返回 false
+func readerLen(reader io.Reader) (int64, bool) {
+	switch r := reader.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	}
+	return 0, false
+}
+
 // ACL Bucket 的读写访问权限
 type ACL string
 
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+// ChecksumBucket 上传时把内容的 SHA-256 记录在元数据 MetaSHA256 中的 Bucket，以便之后
+// 根据内容判断 Object 是否需要更新
+type ChecksumBucket struct {
+	bucket Bucket
+}
+
+// NewChecksumBucket 创建一个 ChecksumBucket
+func NewChecksumBucket(bucket Bucket) *ChecksumBucket {
+	if checksumBucket, ok := bucket.(*ChecksumBucket); ok {
+		return checksumBucket
+	}
+	return &ChecksumBucket{bucket: bucket}
+}
+
+// PutObjectFromFile 上传本地文件
+func (b *ChecksumBucket) PutObjectFromFile(objectKey, filePath string, options ...ObjectOption) (url string, err error) {
+	digest, err := utils.DigestOfFile(filePath)
+	if err != nil {
+		return
+	}
+	return b.bucket.PutObjectFromFile(objectKey, filePath, append(options, WithMeta(MetaSHA256, digest.SHA256))...)
+}
+
+// PutObjectFromBytes 上传 byte 数组
+func (b *ChecksumBucket) PutObjectFromBytes(objectKey string, data []byte, options ...ObjectOption) (url string, err error) {
+	digest, err := utils.DigestOf(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	return b.bucket.PutObjectFromBytes(objectKey, data, append(options, WithMeta(MetaSHA256, digest.SHA256))...)
+}
+
+// PutObject 上传 reader 中的数据，数据会被全部读入内存以便计算摘要
+func (b *ChecksumBucket) PutObject(objectKey string, reader io.Reader, options ...ObjectOption) (url string, err error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return
+	}
+	return b.PutObjectFromBytes(objectKey, data, options...)
+}
+
+// DeleteObject 删除 Object
+func (b *ChecksumBucket) DeleteObject(objectKey string) error {
+	return b.bucket.DeleteObject(objectKey)
+}
+
+// IsObjectExist 判断 Object 是否存在
+func (b *ChecksumBucket) IsObjectExist(objectKey string) (bool, error) {
+	return b.bucket.IsObjectExist(objectKey)
+}
+
+// GetObjectLastModified 获取 Object 最后一次修改的时间
+func (b *ChecksumBucket) GetObjectLastModified(objectKey string) (*time.Time, error) {
+	return b.bucket.GetObjectLastModified(objectKey)
+}
+
+// GetObjectDigest 获取 Object 内容的摘要
+func (b *ChecksumBucket) GetObjectDigest(objectKey string) (*ObjectDigest, error) {
+	return b.bucket.GetObjectDigest(objectKey)
+}
+
+// GetObjectURL 获取 Object 的 URL
+func (b *ChecksumBucket) GetObjectURL(objectKey string) string {
+	return b.bucket.GetObjectURL(objectKey)
+}
+
+// GetName 获取 Bucket 的名称
+func (b *ChecksumBucket) GetName() string {
+	return b.bucket.GetName()
+}
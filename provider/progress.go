@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressListener 上传进度的监听函数，transferred 为已上传的字节数，total 为总字节数，
+// 未知时为 -1
+type ProgressListener func(objectKey string, transferred, total int64)
+
+// ProgressBucket 上传时报告进度的 Bucket
+type ProgressBucket struct {
+	bucket   Bucket
+	listener ProgressListener
+}
+
+// NewProgressBucket 创建一个 ProgressBucket，上传的数据被读取时调用 listener
+func NewProgressBucket(bucket Bucket, listener ProgressListener) *ProgressBucket {
+	return &ProgressBucket{
+		bucket:   bucket,
+		listener: listener,
+	}
+}
+
+// PutObjectFromFile 上传本地文件
+func (b *ProgressBucket) PutObjectFromFile(objectKey, filePath string, options ...ObjectOption) (url string, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	return b.put(objectKey, file, info.Size(), options...)
+}
+
+// PutObjectFromBytes 上传 byte 数组
+func (b *ProgressBucket) PutObjectFromBytes(objectKey string, data []byte, options ...ObjectOption) (url string, err error) {
+	return b.put(objectKey, bytes.NewReader(data), int64(len(data)), options...)
+}
+
+// PutObject 上传 reader 中的数据
+func (b *ProgressBucket) PutObject(objectKey string, reader io.Reader, options ...ObjectOption) (url string, err error) {
+	total, ok := readerLen(reader)
+	if !ok {
+		total = -1
+	}
+	return b.put(objectKey, reader, total, options...)
+}
+
+// put 上传 reader 中的数据，total 可知时保留在 WithContentLength 中
+func (b *ProgressBucket) put(objectKey string, reader io.Reader, total int64, options ...ObjectOption) (string, error) {
+	if total >= 0 {
+		options = append(options, WithContentLength(total))
+	}
+	b.listener(objectKey, 0, total)
+	return b.bucket.PutObject(objectKey, &progressReader{
+		reader: reader,
+		total:  total,
+		listener: func(transferred int64) {
+			b.listener(objectKey, transferred, total)
+		},
+	}, options...)
+}
+
+// DeleteObject 删除 Object
+func (b *ProgressBucket) DeleteObject(objectKey string) error {
+	return b.bucket.DeleteObject(objectKey)
+}
+
+// IsObjectExist 判断 Object 是否存在
+func (b *ProgressBucket) IsObjectExist(objectKey string) (bool, error) {
+	return b.bucket.IsObjectExist(objectKey)
+}
+
+// GetObjectLastModified 获取 Object 最后一次修改的时间
+func (b *ProgressBucket) GetObjectLastModified(objectKey string) (*time.Time, error) {
+	return b.bucket.GetObjectLastModified(objectKey)
+}
+
+// GetObjectDigest 获取 Object 内容的摘要
+func (b *ProgressBucket) GetObjectDigest(objectKey string) (*ObjectDigest, error) {
+	return b.bucket.GetObjectDigest(objectKey)
+}
+
+// GetObjectURL 获取 Object 的 URL
+func (b *ProgressBucket) GetObjectURL(objectKey string) string {
+	return b.bucket.GetObjectURL(objectKey)
+}
+
+// GetName 获取 Bucket 的名称
+func (b *ProgressBucket) GetName() string {
+	return b.bucket.GetName()
+}
+
+// progressReader 读取时报告已读取字节数的 Reader。底层 reader 实现了 io.Seeker 时可以
+// Seek，以便重试时重新上传
+type progressReader struct {
+	reader   io.Reader
+	total    int64
+	read     int64
+	listener func(transferred int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.listener(atomic.AddInt64(&r.read, int64(n)))
+	}
+	return n, err
+}
+
+func (r *progressReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.reader.(io.Seeker)
+	if !ok {
+		return 0, errors.New("reader is not seekable")
+	}
+	position, err := seeker.Seek(offset, whence)
+	if err == nil {
+		atomic.StoreInt64(&r.read, position)
+	}
+	return position, err
+}
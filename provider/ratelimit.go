@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+// RateLimitedBucket 限制请求速率和上传带宽的 Bucket
+type RateLimitedBucket struct {
+	ctx     context.Context
+	bucket  Bucket
+	limiter *utils.RateLimiter
+}
+
+// NewRateLimitedBucket 创建一个 RateLimitedBucket，bucket 的所有请求都受 limiter 的
+// 请求速率限制，上传的数据受 limiter 的带宽限制。ctx 被取消后不再等待
+func NewRateLimitedBucket(ctx context.Context, bucket Bucket, limiter *utils.RateLimiter) *RateLimitedBucket {
+	return &RateLimitedBucket{
+		ctx:     ctx,
+		bucket:  bucket,
+		limiter: limiter,
+	}
+}
+
+// PutObjectFromFile 上传本地文件
+func (b *RateLimitedBucket) PutObjectFromFile(objectKey, filePath string, options ...ObjectOption) (url string, err error) {
+	reader, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	return b.PutObject(objectKey, reader, options...)
+}
+
+// PutObjectFromBytes 上传 byte 数组
+func (b *RateLimitedBucket) PutObjectFromBytes(objectKey string, data []byte, options ...ObjectOption) (url string, err error) {
+	return b.PutObject(objectKey, bytes.NewReader(data), options...)
+}
+
+// PutObject 上传 reader 中的数据，reader 的长度可知时保留在 WithContentLength 中
+func (b *RateLimitedBucket) PutObject(objectKey string, reader io.Reader, options ...ObjectOption) (url string, err error) {
+	if err = b.limiter.WaitRequest(b.ctx); err != nil {
+		return
+	}
+	if length, ok := readerLen(reader); ok {
+		options = append(options, WithContentLength(length))
+	}
+	return b.bucket.PutObject(objectKey, b.limiter.Reader(b.ctx, reader), options...)
+}
+
+// DeleteObject 删除 Object
+func (b *RateLimitedBucket) DeleteObject(objectKey string) error {
+	if err := b.limiter.WaitRequest(b.ctx); err != nil {
+		return err
+	}
+	return b.bucket.DeleteObject(objectKey)
+}
+
+// IsObjectExist 判断 Object 是否存在
+func (b *RateLimitedBucket) IsObjectExist(objectKey string) (bool, error) {
+	if err := b.limiter.WaitRequest(b.ctx); err != nil {
+		return false, err
+	}
+	return b.bucket.IsObjectExist(objectKey)
+}
+
+// GetObjectLastModified 获取 Object 最后一次修改的时间
+func (b *RateLimitedBucket) GetObjectLastModified(objectKey string) (*time.Time, error) {
+	if err := b.limiter.WaitRequest(b.ctx); err != nil {
+		return nil, err
+	}
+	return b.bucket.GetObjectLastModified(objectKey)
+}
+
+// GetObjectDigest 获取 Object 内容的摘要
+func (b *RateLimitedBucket) GetObjectDigest(objectKey string) (*ObjectDigest, error) {
+	if err := b.limiter.WaitRequest(b.ctx); err != nil {
+		return nil, err
+	}
+	return b.bucket.GetObjectDigest(objectKey)
+}
+
+// GetObjectURL 获取 Object 的 URL
+func (b *RateLimitedBucket) GetObjectURL(objectKey string) string {
+	return b.bucket.GetObjectURL(objectKey)
+}
+
+// GetName 获取 Bucket 的名称
+func (b *RateLimitedBucket) GetName() string {
+	return b.bucket.GetName()
+}
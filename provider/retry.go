@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/slipfre/imgmd/utils"
+)
+
+// RetryBucket 按照重试策略重试失败的请求的 Bucket
+type RetryBucket struct {
+	ctx    context.Context
+	bucket Bucket
+	policy utils.RetryPolicy
+}
+
+// NewRetryBucket 创建一个 RetryBucket，bucket 的请求遇到可重试的错误时按照 policy 重试，
+// ctx 被取消后不再重试
+func NewRetryBucket(ctx context.Context, bucket Bucket, policy utils.RetryPolicy) *RetryBucket {
+	return &RetryBucket{
+		ctx:    ctx,
+		bucket: bucket,
+		policy: policy,
+	}
+}
+
+// PutObjectFromFile 上传本地文件
+func (b *RetryBucket) PutObjectFromFile(objectKey, filePath string, options ...ObjectOption) (url string, err error) {
+	err = b.policy.Retry(b.ctx, func() (err error) {
+		url, err = b.bucket.PutObjectFromFile(objectKey, filePath, options...)
+		return
+	})
+	return
+}
+
+// PutObjectFromBytes 上传 byte 数组
+func (b *RetryBucket) PutObjectFromBytes(objectKey string, data []byte, options ...ObjectOption) (url string, err error) {
+	err = b.policy.Retry(b.ctx, func() (err error) {
+		url, err = b.bucket.PutObjectFromBytes(objectKey, data, options...)
+		return
+	})
+	return
+}
+
+// PutObject 上传 reader 中的数据，只有 reader 实现了 io.Seeker 时才会重试
+func (b *RetryBucket) PutObject(objectKey string, reader io.Reader, options ...ObjectOption) (url string, err error) {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return b.bucket.PutObject(objectKey, reader, options...)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return b.bucket.PutObject(objectKey, reader, options...)
+	}
+	err = b.policy.Retry(b.ctx, func() (err error) {
+		if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+			return
+		}
+		url, err = b.bucket.PutObject(objectKey, reader, options...)
+		return
+	})
+	return
+}
+
+// DeleteObject 删除 Object
+func (b *RetryBucket) DeleteObject(objectKey string) error {
+	return b.policy.Retry(b.ctx, func() error {
+		return b.bucket.DeleteObject(objectKey)
+	})
+}
+
+// IsObjectExist 判断 Object 是否存在
+func (b *RetryBucket) IsObjectExist(objectKey string) (isExist bool, err error) {
+	err = b.policy.Retry(b.ctx, func() (err error) {
+		isExist, err = b.bucket.IsObjectExist(objectKey)
+		return
+	})
+	return
+}
+
+// GetObjectLastModified 获取 Object 最后一次修改的时间
+func (b *RetryBucket) GetObjectLastModified(objectKey string) (lastModified *time.Time, err error) {
+	err = b.policy.Retry(b.ctx, func() (err error) {
+		lastModified, err = b.bucket.GetObjectLastModified(objectKey)
+		return
+	})
+	return
+}
+
+// GetObjectDigest 获取 Object 内容的摘要
+func (b *RetryBucket) GetObjectDigest(objectKey string) (digest *ObjectDigest, err error) {
+	err = b.policy.Retry(b.ctx, func() (err error) {
+		digest, err = b.bucket.GetObjectDigest(objectKey)
+		return
+	})
+	return
+}
+
+// GetObjectURL 获取 Object 的 URL
+func (b *RetryBucket) GetObjectURL(objectKey string) string {
+	return b.bucket.GetObjectURL(objectKey)
+}
+
+// GetName 获取 Bucket 的名称
+func (b *RetryBucket) GetName() string {
+	return b.bucket.GetName()
+}
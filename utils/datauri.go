@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// IsDataURI 判断 uri 是否为 data URI
+func IsDataURI(uri string) bool {
+	return strings.HasPrefix(strings.ToLower(uri), "data:")
+}
+
+// DecodeDataURI 解析 data URI，返回其中的数据和 MIME 类型
+func DecodeDataURI(uri string) (data []byte, mimeType string, err error) {
+	if !IsDataURI(uri) {
+		err = errors.New("not a data uri")
+		return
+	}
+	comma := strings.Index(uri, ",")
+	if comma < 0 {
+		err = errors.New("invalid data uri: missing ','")
+		return
+	}
+
+	header, payload := uri[len("data:"):comma], uri[comma+1:]
+	isBase64 := false
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		isBase64 = true
+		header = header[:len(header)-len(";base64")]
+	}
+	mimeType = header
+	if mimeType == "" || strings.HasPrefix(mimeType, ";") {
+		mimeType = "text/plain" + mimeType
+	}
+
+	if isBase64 {
+		data, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+		return
+	}
+	unescaped, err := url.PathUnescape(payload)
+	data = []byte(unescaped)
+	return
+}
+
+// EncodeDataURI 将数据编码为 base64 形式的 data URI
+func EncodeDataURI(data []byte, mimeType string) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
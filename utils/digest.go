@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc64"
+	"io"
+	"os"
+)
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// Digest 内容的摘要，包括 SHA-256、MD5 以及对象存储常用的 CRC64 (ECMA)
+type Digest struct {
+	SHA256 string
+	MD5    string
+	CRC64  uint64
+}
+
+// DigestOf 读取 reader 中的全部内容并计算摘要
+func DigestOf(reader io.Reader) (*Digest, error) {
+	sha256Hash, md5Hash, crc64Hash := sha256.New(), md5.New(), crc64.New(crc64Table)
+	if _, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash, crc64Hash), reader); err != nil {
+		return nil, err
+	}
+	return &Digest{
+		SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+		MD5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		CRC64:  crc64Hash.Sum64(),
+	}, nil
+}
+
+// DigestOfFile 计算文件内容的摘要
+func DigestOfFile(path string) (*Digest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return DigestOf(file)
+}
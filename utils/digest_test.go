@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"hash/crc64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestOf(t *testing.T) {
+	digest, err := DigestOf(strings.NewReader("abc"))
+	require.Nil(t, err)
+	require.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", digest.SHA256)
+	require.Equal(t, "900150983cd24fb0d6963f7d28e17f72", digest.MD5)
+	require.Equal(t, crc64.Checksum([]byte("abc"), crc64.MakeTable(crc64.ECMA)), digest.CRC64)
+
+	path := filepath.Join(t.TempDir(), "abc.txt")
+	require.Nil(t, ioutil.WriteFile(path, []byte("abc"), 0666))
+	fileDigest, err := DigestOfFile(path)
+	require.Nil(t, err)
+	require.Equal(t, digest, fileDigest)
+
+	_, err = DigestOfFile(filepath.Join(t.TempDir(), "missing.txt"))
+	require.NotNil(t, err)
+}
+
+func TestGetUpdatedTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	require.Nil(t, ioutil.WriteFile(path, []byte("file"), 0666))
+	updatedTime, err := GetUpdatedTime(path)
+	require.Nil(t, err)
+	require.NotNil(t, updatedTime)
+	require.WithinDuration(t, time.Now(), *updatedTime, time.Minute)
+
+	_, err = GetUpdatedTime(path + ".missing")
+	require.NotNil(t, err)
+}
@@ -1,13 +1,21 @@
 package utils
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
+// HTTPTimeout 下载一个 HTTP/HTTPS 文件的超时时间，包括读取响应体的时间
+const HTTPTimeout = 5 * time.Minute
+
+// httpClient 下载 HTTP/HTTPS 文件的 client
+var httpClient = &http.Client{Timeout: HTTPTimeout}
+
 // DownloadFile 根据 srcURI 下载 media 文件到 target 指示的位置
 func DownloadFile(srcURI, target string) (err error) {
 	in, err := NewFileReader(srcURI)
@@ -16,34 +24,112 @@ func DownloadFile(srcURI, target string) (err error) {
 	}
 	defer in.Close()
 
-	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
-	if err != nil {
-		return
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, in)
-	return
+	return WriteReaderAtomic(target, in, 0777)
 }
 
 // NewFileReader 根据 srcURI 的类型，创建 reader
 func NewFileReader(srcURI string) (reader io.ReadCloser, err error) {
-	if strings.HasPrefix(srcURI, "http://") || strings.HasPrefix(srcURI, "https://") {
+	if IsHTTPURI(srcURI) {
 		return NewHTTPHTTPSFileReader(srcURI)
 	}
 	return NewLocalFileReader(srcURI)
 }
 
+// IsHTTPURI 判断 uri 是否为 HTTP/HTTPS 类型的 url
+func IsHTTPURI(uri string) bool {
+	return strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")
+}
+
+// rateLimitedBody 受带宽限制的响应体
+type rateLimitedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// HTTPDownloader 下载 HTTP/HTTPS 类型的文件，请求遇到可重试的错误时按照重试策略重试，
+// 并受速率限制。nil 表示按照默认的重试策略重试，不限制速率
+type HTTPDownloader struct {
+	policy  RetryPolicy
+	limiter *RateLimiter
+}
+
+// NewHTTPDownloader 创建一个 HTTPDownloader，请求遇到可重试的错误时按照 policy 重试，
+// 请求速率和下载带宽受 limiter 限制，limiter 为 nil 表示不限制
+func NewHTTPDownloader(policy RetryPolicy, limiter *RateLimiter) *HTTPDownloader {
+	return &HTTPDownloader{policy: policy, limiter: limiter}
+}
+
+// defaultHTTPDownloader 按照默认的重试策略重试，不限制速率的 HTTPDownloader
+var defaultHTTPDownloader = NewHTTPDownloader(DefaultRetryPolicy(), nil)
+
 // NewHTTPHTTPSFileReader 创建 HTTP/HTTPS 类型的 MediaReader，从网络中读取 media 文件
 func NewHTTPHTTPSFileReader(srcURI string) (reader io.ReadCloser, err error) {
-	resp, err := http.Get(srcURI)
+	return defaultHTTPDownloader.NewReader(context.Background(), srcURI)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("bad status: %s", resp.Status)
-		return
+// FetchHTTPHTTPSFile 下载 HTTP/HTTPS 类型的 media 文件，返回文件内容和响应头
+func FetchHTTPHTTPSFile(srcURI string) (data []byte, header http.Header, err error) {
+	return defaultHTTPDownloader.Fetch(context.Background(), srcURI)
+}
+
+// get 发送 GET 请求，ctx 被取消时请求和响应体的读取都会中止
+func get(ctx context.Context, srcURI string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srcURI, nil)
+	if err != nil {
+		return nil, err
 	}
+	return httpClient.Do(req)
+}
+
+// NewReader 创建从网络中读取 media 文件的 reader，ctx 被取消时不再重试
+func (d *HTTPDownloader) NewReader(ctx context.Context, srcURI string) (reader io.ReadCloser, err error) {
+	if d == nil {
+		d = defaultHTTPDownloader
+	}
+	err = d.policy.Retry(ctx, func() error {
+		if err := d.limiter.WaitRequest(ctx); err != nil {
+			return err
+		}
+		resp, err := get(ctx, srcURI)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return NewStatusError(resp)
+		}
+		reader = rateLimitedBody{
+			Reader: d.limiter.Reader(ctx, resp.Body),
+			Closer: resp.Body,
+		}
+		return nil
+	})
+	return
+}
 
-	reader = resp.Body
+// Fetch 下载 media 文件，返回文件内容和响应头，ctx 被取消时不再重试
+func (d *HTTPDownloader) Fetch(ctx context.Context, srcURI string) (data []byte, header http.Header, err error) {
+	if d == nil {
+		d = defaultHTTPDownloader
+	}
+	err = d.policy.Retry(ctx, func() error {
+		if err := d.limiter.WaitRequest(ctx); err != nil {
+			return err
+		}
+		resp, err := get(ctx, srcURI)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return NewStatusError(resp)
+		}
+		if data, err = ioutil.ReadAll(d.limiter.Reader(ctx, resp.Body)); err != nil {
+			return err
+		}
+		header = resp.Header
+		return nil
+	})
 	return
 }
 
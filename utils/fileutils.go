@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -31,7 +34,7 @@ func IsFileExist(path string) bool {
 // GetUpdatedTime Get file's last updated time
 func GetUpdatedTime(path string) (*time.Time, error) {
 	fi, fError := os.Stat(path)
-	if fError != nil {
+	if fError == nil {
 		updatedTime := fi.ModTime()
 		return &updatedTime, nil
 	}
@@ -46,3 +49,40 @@ func GetTargetResourcesDirPath(parentDestPath string) string {
 	filename := strings.TrimSuffix(filenameWithSuffix, suffix)
 	return filepath.Join(directory, filename) + "_medias"
 }
+
+// WriteFileAtomic Write data to a temporary file beside path, and rename it to
+// path, so that path is either the old file or the complete new one
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return WriteReaderAtomic(path, bytes.NewReader(data), perm)
+}
+
+// WriteReaderAtomic Write the content of reader to path atomically, see
+// WriteFileAtomic
+func WriteReaderAtomic(path string, reader io.Reader, perm os.FileMode) (err error) {
+	if err = CreateDirectory(filepath.Dir(path)); err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
+	if _, err = io.Copy(temp, reader); err != nil {
+		return err
+	}
+	if err = temp.Sync(); err != nil {
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(temp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+var extensionsByMIMEType = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/bmp":     ".bmp",
+	"image/svg+xml": ".svg",
+	"image/x-icon":  ".ico",
+}
+
+// ExtensionByMIMEType 获取 MIME 类型对应的文件扩展名，未知类型返回 ".bin"
+func ExtensionByMIMEType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(mimeType))
+	}
+	if ext, ok := extensionsByMIMEType[mediaType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// DetectMIMEType 获取文件的 MIME 类型，优先根据 uri 的扩展名判断，无法判断时根据
+// 文件内容判断。返回的类型不含参数
+func DetectMIMEType(uri string, data []byte) string {
+	if i := strings.IndexAny(uri, "?#"); i >= 0 && IsHTTPURI(uri) {
+		uri = uri[:i]
+	}
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(uri)))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return mediaType
+	}
+	return mimeType
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter 限制请求速率和传输带宽，nil 表示不限制
+type RateLimiter struct {
+	requests *rate.Limiter
+	bytes    *rate.Limiter
+}
+
+// NewRateLimiter 创建 RateLimiter，每秒最多发起 requestsPerSecond 个请求，传输
+// bytesPerSecond 个字节，不大于 0 表示不限制。两者都不限制时返回 nil
+func NewRateLimiter(requestsPerSecond float64, bytesPerSecond int) *RateLimiter {
+	if requestsPerSecond <= 0 && bytesPerSecond <= 0 {
+		return nil
+	}
+	limiter := &RateLimiter{}
+	if requestsPerSecond > 0 {
+		limiter.requests = rate.NewLimiter(rate.Limit(requestsPerSecond), int(math.Max(1, requestsPerSecond)))
+	}
+	if bytesPerSecond > 0 {
+		limiter.bytes = rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)
+	}
+	return limiter
+}
+
+// WaitRequest 等待直到允许发起一个请求
+func (l *RateLimiter) WaitRequest(ctx context.Context) error {
+	if l == nil || l.requests == nil {
+		return nil
+	}
+	return l.requests.Wait(ctx)
+}
+
+// Reader 返回一个受带宽限制的 reader
+func (l *RateLimiter) Reader(ctx context.Context, reader io.Reader) io.Reader {
+	if l == nil || l.bytes == nil {
+		return reader
+	}
+	return &rateLimitedReader{ctx: ctx, reader: reader, limiter: l.bytes}
+}
+
+// rateLimitedReader 受带宽限制的 reader，每次读取的字节数不超过 limiter 的突发容量。
+// 底层 reader 实现了 io.Seeker 时可以 Seek，以便重试时重新上传
+type rateLimitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *rateLimitedReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.reader.(io.Seeker)
+	if !ok {
+		return 0, errors.New("reader is not seekable")
+	}
+	return seeker.Seek(offset, whence)
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	require.Nil(t, NewRateLimiter(0, 0))
+
+	// A nil limiter does not limit anything
+	var unlimited *RateLimiter
+	require.Nil(t, unlimited.WaitRequest(context.Background()))
+	reader := strings.NewReader("content")
+	require.Equal(t, reader, unlimited.Reader(context.Background(), reader))
+
+	// The first second is the burst, the rest is limited
+	limiter := NewRateLimiter(0, 1000)
+	start := time.Now()
+	data, err := ioutil.ReadAll(limiter.Reader(context.Background(), bytes.NewReader(make([]byte, 1500))))
+	require.Nil(t, err)
+	require.Len(t, data, 1500)
+	require.True(t, time.Since(start) >= 400*time.Millisecond, time.Since(start))
+
+	// The limited reader seeks if the source does, and not otherwise
+	seeker, ok := limiter.Reader(context.Background(), strings.NewReader("content")).(io.Seeker)
+	require.True(t, ok)
+	position, err := seeker.Seek(3, io.SeekStart)
+	require.Nil(t, err)
+	require.Equal(t, int64(3), position)
+	_, err = limiter.Reader(context.Background(), ioutil.NopCloser(strings.NewReader("content"))).(io.Seeker).Seek(0, io.SeekStart)
+	require.NotNil(t, err)
+
+	limiter = NewRateLimiter(20, 0)
+	start = time.Now()
+	for i := 0; i < 30; i++ {
+		require.Nil(t, limiter.WaitRequest(context.Background()))
+	}
+	require.True(t, time.Since(start) >= 400*time.Millisecond, time.Since(start))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NotNil(t, limiter.WaitRequest(ctx))
+}
+
+func TestDownloader_rateLimitHTTPHTTPSFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1500))
+	}))
+	defer server.Close()
+
+	downloader := NewHTTPDownloader(DefaultRetryPolicy(), NewRateLimiter(0, 1000))
+	start := time.Now()
+	data, _, err := downloader.Fetch(context.Background(), server.URL)
+	require.Nil(t, err)
+	require.Len(t, data, 1500)
+	require.True(t, time.Since(start) >= 400*time.Millisecond, time.Since(start))
+}
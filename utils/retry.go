@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy 重试策略，失败后按指数退避并加入随机抖动等待，再次尝试
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数，包括第一次尝试，小于 1 时视为 1
+	MaxAttempts int
+	// BaseDelay 第一次重试前等待的时长，之后每次翻倍
+	BaseDelay time.Duration
+	// MaxDelay 重试前等待的最大时长
+	MaxDelay time.Duration
+	// OnRetry 每次重试前等待结束后调用，attempt 为即将进行的尝试的序号，可以为空
+	OnRetry func(attempt int, err error)
+}
+
+// DefaultRetryPolicy 默认的重试策略，最多尝试 3 次
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+// Retry 按照重试策略执行 fn，直到成功、遇到不可重试的错误或者达到最大尝试次数，
+// 返回最后一次执行的错误。等待重试时 ctx 被取消则不再重试，返回 ctx 的错误
+func (p RetryPolicy) Retry(ctx context.Context, fn func() error) error {
+	err := fn()
+	for attempt := 2; attempt <= p.MaxAttempts && IsRetryable(err); attempt++ {
+		timer := time.NewTimer(p.backoff(attempt - 1))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err)
+		}
+		err = fn()
+	}
+	return err
+}
+
+// backoff 第 retry 次重试前等待的时长，在指数退避时长的一半到全部之间随机选取
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// StatusError 带有 HTTP 状态码的错误
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+// NewStatusError 根据 HTTP 响应创建 StatusError
+func NewStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Err:        fmt.Errorf("bad status: %s", resp.Status),
+	}
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap 返回原始错误
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable 判断错误是否为暂时性的错误，即重试可能成功。超时、连接被拒绝或重置，
+// 暂时性的网络错误，以及 408、429 和 5xx 状态码是可重试的，其余错误如文件不存在、
+// 权限不足、地址无效不可重试
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		code := statusError.StatusCode
+		return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return dnsError.IsTemporary
+	}
+	var opError *net.OpError
+	return errors.As(err, &opError) && opError.Temporary()
+}
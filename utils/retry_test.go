@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_retry(t *testing.T) {
+	retried := 0
+	policy := RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    2 * time.Millisecond,
+		OnRetry:     func(attempt int, err error) { retried++ },
+	}
+
+	attempts := 0
+	err := policy.Retry(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return &StatusError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("503")}
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, 2, retried)
+
+	attempts = 0
+	err = policy.Retry(context.Background(), func() error {
+		attempts++
+		return &StatusError{StatusCode: http.StatusInternalServerError, Err: errors.New("500")}
+	})
+	require.NotNil(t, err)
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = policy.Retry(context.Background(), func() error {
+		attempts++
+		return &StatusError{StatusCode: http.StatusNotFound, Err: errors.New("404")}
+	})
+	require.NotNil(t, err)
+	require.Equal(t, 1, attempts)
+
+	// Waiting for the retry stops once the context is done
+	policy.BaseDelay, policy.MaxDelay = time.Minute, time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	attempts, retried = 0, 0
+	err = policy.Retry(ctx, func() error {
+		attempts++
+		return &StatusError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("503")}
+	})
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Equal(t, 1, attempts)
+	require.Equal(t, 0, retried)
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for retry, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		delay := policy.backoff(retry + 1)
+		require.True(t, delay >= max*time.Millisecond/2 && delay <= max*time.Millisecond, delay)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	require.False(t, IsRetryable(nil))
+	require.False(t, IsRetryable(context.Canceled))
+	require.False(t, IsRetryable(os.ErrNotExist))
+	require.True(t, IsRetryable(&StatusError{StatusCode: http.StatusTooManyRequests, Err: errors.New("429")}))
+	require.False(t, IsRetryable(&StatusError{StatusCode: http.StatusForbidden, Err: errors.New("403")}))
+
+	_, err := http.Get("http://127.0.0.1:1/")
+	require.True(t, IsRetryable(err))
+	require.False(t, IsRetryable(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("invalid address")}))
+}
+
+func TestDownloader_retryHTTPHTTPSFile(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	retried := 0
+	policy := RetryPolicy{MaxAttempts: 2, OnRetry: func(attempt int, err error) { retried++ }}
+	data, _, err := NewHTTPDownloader(policy, nil).Fetch(context.Background(), server.URL)
+	require.Nil(t, err)
+	require.Equal(t, "content", string(data))
+	require.Equal(t, 2, requests)
+	require.Equal(t, 1, retried)
+}
+
+func TestHTTPDownloader_cancel(t *testing.T) {
+	stopped := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(stopped)
+	}))
+	defer server.Close()
+
+	// The request in flight is aborted once the context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := NewHTTPDownloader(RetryPolicy{MaxAttempts: 3}, nil).Fetch(ctx, server.URL)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("request is not aborted")
+	}
+}